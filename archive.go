@@ -0,0 +1,57 @@
+package statushub
+
+import "encoding/json"
+
+// ArchiveVersion is the version of the archive format
+// produced by the export API.
+//
+// An archive is a tar file containing:
+//
+//   - manifest.json: an ArchiveManifest.
+//   - services.ndjson: one ArchiveService per line.
+//   - records.ndjson: one LogRecord per line, by ID.
+//   - media/<id>: the contents of each media record.
+//   - media.ndjson: one MediaRecord per line, by ID.
+const ArchiveVersion = 1
+
+// An ArchiveManifest describes an exported archive.
+type ArchiveManifest struct {
+	Version int   `json:"version"`
+	Time    int64 `json:"time"`
+}
+
+// An ArchiveService stores the metadata of a service in
+// an exported archive.
+type ArchiveService struct {
+	Service string `json:"service"`
+	Labels  Labels `json:"labels,omitempty"`
+
+	// Info is the service's info as set by SetServiceInfo.
+	Info json.RawMessage `json:"info,omitempty"`
+
+	// Progress is the service's latest progress, if it has
+	// reported any with SetProgress.
+	// Only Done, Total and Time are used when importing.
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// ImportOptions controls how an archive is imported.
+type ImportOptions struct {
+	// Replace causes all existing services and media to be
+	// deleted before the import.
+	// Otherwise, the archive is merged into the server's
+	// existing state.
+	Replace bool `json:"replace"`
+
+	// RemapIDs assigns new IDs to every imported record.
+	// Without it, the archive's IDs are kept, and merging
+	// fails if they collide with existing IDs.
+	RemapIDs bool `json:"remapIDs"`
+}
+
+// ImportStats summarizes an import.
+type ImportStats struct {
+	Services int `json:"services"`
+	Records  int `json:"records"`
+	Media    int `json:"media"`
+}
@@ -0,0 +1,470 @@
+package statushub
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/unixpickle/essentials"
+)
+
+// Default settings for an AsyncLogger.
+const (
+	DefaultAsyncBatchSize     = 100
+	DefaultAsyncFlushInterval = time.Second * 5
+	DefaultAsyncMaxQueued     = 10000
+)
+
+// AsyncOptions configures an AsyncLogger.
+//
+// Zero fields are replaced with defaults.
+type AsyncOptions struct {
+	// BatchSize is the number of queued messages for a
+	// service which triggers an early flush.
+	// It is also the maximum size of each AddBatch call.
+	BatchSize int
+
+	// FlushInterval is the maximum amount of time that a
+	// message sits in the queue before a flush.
+	FlushInterval time.Duration
+
+	// MaxQueued bounds the number of messages held in
+	// memory.
+	// Messages logged while the queue is full are dropped.
+	MaxQueued int
+
+	// SpoolPath, if set, is a file to which messages are
+	// written when the server cannot be reached.
+	// Spooled messages are replayed in order once the
+	// server is reachable again, even if that is in a
+	// later process.
+	//
+	// Without a spool file, undelivered messages stay in
+	// the in-memory queue.
+	SpoolPath string
+}
+
+// AsyncStats contains counters for an AsyncLogger.
+type AsyncStats struct {
+	// Sent is the number of messages delivered.
+	Sent int64
+
+	// Dropped is the number of messages which were lost,
+	// either because the queue was full or because the
+	// server rejected them.
+	Dropped int64
+
+	// Retried is the number of delivery attempts for
+	// messages which failed to send before.
+	Retried int64
+
+	// Spooled is the number of messages written to the
+	// spool file.
+	Spooled int64
+}
+
+// An AsyncLogger queues log messages and submits them to
+// the server in the background.
+//
+// Logging never blocks on the network, so a slow or
+// unreachable server does not stall the caller.
+type AsyncLogger struct {
+	client *Client
+	opts   AsyncOptions
+
+	lock    sync.Mutex
+	queue   []asyncEntry
+	failed  []asyncBatch
+	stats   AsyncStats
+	lastErr error
+	closed  bool
+
+	// Only accessed by the background Goroutine.
+	spool        *os.File
+	spoolPending bool
+	spoolOffset  int64
+
+	wake     chan struct{}
+	flushReq chan chan error
+	closeReq chan chan error
+	done     chan struct{}
+}
+
+type asyncEntry struct {
+	Service string
+	Entry   Entry
+}
+
+// An asyncBatch is a group of messages which is sent in a
+// single AddBatch call.
+//
+// Each batch keeps its idempotency key across retries and
+// in the spool, so a batch which reached the server before
+// an error is never added twice.
+type asyncBatch struct {
+	Service string  `json:"service"`
+	Key     string  `json:"key,omitempty"`
+	Entries []Entry `json:"entries"`
+	Failed  bool    `json:"-"`
+}
+
+// NewAsyncLogger creates an AsyncLogger that submits
+// messages through the client.
+//
+// If opts is nil, default options are used.
+//
+// The caller should Close the logger when done with it to
+// deliver the remaining messages.
+func NewAsyncLogger(c *Client, opts *AsyncOptions) (*AsyncLogger, error) {
+	l := &AsyncLogger{
+		client:   c,
+		wake:     make(chan struct{}, 1),
+		flushReq: make(chan chan error),
+		closeReq: make(chan chan error),
+		done:     make(chan struct{}),
+	}
+	if opts != nil {
+		l.opts = *opts
+	}
+	if l.opts.BatchSize <= 0 {
+		l.opts.BatchSize = DefaultAsyncBatchSize
+	}
+	if l.opts.FlushInterval <= 0 {
+		l.opts.FlushInterval = DefaultAsyncFlushInterval
+	}
+	if l.opts.MaxQueued <= 0 {
+		l.opts.MaxQueued = DefaultAsyncMaxQueued
+	}
+	if l.opts.SpoolPath != "" {
+		f, err := os.OpenFile(l.opts.SpoolPath, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, essentials.AddCtx("open spool", err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, essentials.AddCtx("open spool", err)
+		}
+		l.spool = f
+		l.spoolPending = info.Size() > 0
+	}
+	go l.loop()
+	return l, nil
+}
+
+// Log queues a message for a service.
+//
+// If the queue is full or the logger is closed, the
+// message is dropped.
+func (l *AsyncLogger) Log(service, message string) {
+	l.LogEntry(service, Entry{Message: message})
+}
+
+// LogEntry is like Log, but the message may have metadata
+// such as a level.
+func (l *AsyncLogger) LogEntry(service string, entry Entry) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed || l.numQueued() >= l.opts.MaxQueued {
+		l.stats.Dropped++
+		return
+	}
+	l.queue = append(l.queue, asyncEntry{Service: service, Entry: entry})
+	if len(l.queue) >= l.opts.BatchSize {
+		select {
+		case l.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush attempts to deliver every queued message.
+//
+// It returns an error if some messages could not be
+// delivered, in which case they remain spooled or queued.
+func (l *AsyncLogger) Flush() error {
+	ch := make(chan error, 1)
+	select {
+	case l.flushReq <- ch:
+		return <-ch
+	case <-l.done:
+		return errors.New("flush async logger: logger is closed")
+	}
+}
+
+// Close flushes the logger and stops it.
+//
+// Messages which cannot be delivered are written to the
+// spool file, if there is one, and lost otherwise.
+func (l *AsyncLogger) Close() error {
+	l.lock.Lock()
+	if l.closed {
+		l.lock.Unlock()
+		return errors.New("close async logger: logger is already closed")
+	}
+	l.closed = true
+	l.lock.Unlock()
+
+	ch := make(chan error, 1)
+	l.closeReq <- ch
+	return <-ch
+}
+
+// Stats returns the current counters.
+func (l *AsyncLogger) Stats() AsyncStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.stats
+}
+
+// LastError returns the most recent delivery error, or
+// nil if the last delivery succeeded.
+func (l *AsyncLogger) LastError() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.lastErr
+}
+
+func (l *AsyncLogger) loop() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.deliver(false)
+		case <-l.wake:
+			l.deliver(false)
+		case ch := <-l.flushReq:
+			ch <- l.deliver(false)
+		case ch := <-l.closeReq:
+			err := l.deliver(true)
+			if l.spool != nil {
+				if closeErr := l.spool.Close(); err == nil {
+					err = essentials.AddCtx("close spool", closeErr)
+				}
+			}
+			ch <- err
+			return
+		}
+	}
+}
+
+// deliver sends the spool, then previously failed
+// batches, and then the queue.
+//
+// If final is set, undeliverable messages are not kept in
+// memory.
+func (l *AsyncLogger) deliver(final bool) error {
+	spoolErr := l.replaySpool()
+
+	l.lock.Lock()
+	batches := append(l.failed, l.groupBatches(l.queue)...)
+	l.failed = nil
+	l.queue = nil
+	l.lock.Unlock()
+
+	var err error
+	var requeue []asyncBatch
+	for _, batch := range batches {
+		if err == nil && spoolErr == nil {
+			err = l.sendBatch(batch)
+			if err == nil {
+				continue
+			} else if !IsTransient(err) {
+				// The server will never accept these messages.
+				l.lock.Lock()
+				l.stats.Dropped += int64(len(batch.Entries))
+				l.lock.Unlock()
+				err = nil
+				continue
+			}
+		}
+		if l.spool != nil {
+			if writeErr := l.writeSpool(batch); writeErr == nil {
+				continue
+			} else if err == nil {
+				err = writeErr
+			}
+		}
+		batch.Failed = true
+		requeue = append(requeue, batch)
+	}
+	if err == nil {
+		err = spoolErr
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if final {
+		for _, batch := range requeue {
+			l.stats.Dropped += int64(len(batch.Entries))
+		}
+	} else {
+		// Failed batches are sent ahead of anything logged in
+		// the meantime to preserve ordering.
+		l.failed = requeue
+		l.trimQueue()
+	}
+	l.lastErr = err
+	return essentials.AddCtx("deliver log messages", err)
+}
+
+// numQueued counts the messages held in memory.
+//
+// The caller must hold l.lock.
+func (l *AsyncLogger) numQueued() int {
+	n := len(l.queue)
+	for _, batch := range l.failed {
+		n += len(batch.Entries)
+	}
+	return n
+}
+
+// trimQueue drops the newest messages until the memory
+// bound is satisfied.
+//
+// The caller must hold l.lock.
+func (l *AsyncLogger) trimQueue() {
+	overflow := l.numQueued() - l.opts.MaxQueued
+	if overflow <= 0 {
+		return
+	}
+	l.stats.Dropped += int64(overflow)
+	if overflow <= len(l.queue) {
+		l.queue = l.queue[:len(l.queue)-overflow]
+		return
+	}
+	overflow -= len(l.queue)
+	l.queue = nil
+	for overflow > 0 {
+		last := &l.failed[len(l.failed)-1]
+		if overflow >= len(last.Entries) {
+			overflow -= len(last.Entries)
+			l.failed = l.failed[:len(l.failed)-1]
+		} else {
+			// The shortened batch gets a new key, since the server
+			// may have seen the full batch under the old one.
+			last.Entries = last.Entries[:len(last.Entries)-overflow]
+			last.Key = NewIdempotencyKey()
+			overflow = 0
+		}
+	}
+}
+
+// groupBatches splits entries into batches for a single
+// service, preserving the order of each service's
+// messages.
+func (l *AsyncLogger) groupBatches(entries []asyncEntry) []asyncBatch {
+	var services []string
+	perService := map[string][]Entry{}
+	for _, entry := range entries {
+		if _, ok := perService[entry.Service]; !ok {
+			services = append(services, entry.Service)
+		}
+		perService[entry.Service] = append(perService[entry.Service], entry.Entry)
+	}
+	var batches []asyncBatch
+	for _, service := range services {
+		entries := perService[service]
+		for len(entries) > 0 {
+			n := len(entries)
+			if n > l.opts.BatchSize {
+				n = l.opts.BatchSize
+			}
+			batches = append(batches, asyncBatch{
+				Service: service,
+				Key:     NewIdempotencyKey(),
+				Entries: entries[:n],
+			})
+			entries = entries[n:]
+		}
+	}
+	return batches
+}
+
+func (l *AsyncLogger) sendBatch(batch asyncBatch) error {
+	_, err := l.client.AddEntriesKeyContext(context.Background(), batch.Service, batch.Key,
+		batch.Entries)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if batch.Failed {
+		l.stats.Retried += int64(len(batch.Entries))
+	}
+	if err == nil {
+		l.stats.Sent += int64(len(batch.Entries))
+	}
+	return err
+}
+
+func (l *AsyncLogger) writeSpool(batch asyncBatch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	if _, err := l.spool.Seek(0, io.SeekEnd); err != nil {
+		return essentials.AddCtx("write spool", err)
+	}
+	if _, err := l.spool.Write(append(data, '\n')); err != nil {
+		return essentials.AddCtx("write spool", err)
+	}
+	l.spoolPending = true
+
+	l.lock.Lock()
+	l.stats.Spooled += int64(len(batch.Entries))
+	l.lock.Unlock()
+	return nil
+}
+
+// replaySpool sends every batch in the spool file and
+// then truncates it.
+//
+// If delivery fails, the position in the file is saved so
+// that the next replay resumes where this one left off.
+func (l *AsyncLogger) replaySpool() error {
+	if !l.spoolPending {
+		return nil
+	}
+	if _, err := l.spool.Seek(l.spoolOffset, io.SeekStart); err != nil {
+		return essentials.AddCtx("replay spool", err)
+	}
+	r := bufio.NewReader(l.spool)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Ignore a trailing partial line from an
+			// interrupted write.
+			break
+		} else if err != nil {
+			return essentials.AddCtx("replay spool", err)
+		}
+		var batch asyncBatch
+		if err := json.Unmarshal(line, &batch); err == nil && len(batch.Entries) > 0 {
+			if batch.Key == "" {
+				batch.Key = NewIdempotencyKey()
+			}
+			batch.Failed = true
+			if err := l.sendBatch(batch); err != nil {
+				if IsTransient(err) {
+					return err
+				}
+				l.lock.Lock()
+				l.stats.Dropped += int64(len(batch.Entries))
+				l.lock.Unlock()
+			}
+		}
+		l.spoolOffset += int64(len(line))
+	}
+	if err := l.spool.Truncate(0); err != nil {
+		return essentials.AddCtx("replay spool", err)
+	}
+	l.spoolOffset = 0
+	l.spoolPending = false
+	return nil
+}
@@ -8,14 +8,24 @@ package statushub
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/unixpickle/essentials"
@@ -25,8 +35,54 @@ import (
 type LogRecord struct {
 	Service string `json:"serviceName"`
 	Message string `json:"message"`
+	Level   Level  `json:"level,omitempty"`
 	Time    int64  `json:"time"`
 	ID      int    `json:"id"`
+
+	// Labels contains the labels of the record, merged
+	// with the labels of its service.
+	Labels Labels `json:"labels,omitempty"`
+
+	// MediaIDs lists the media records attached to the
+	// record, such as samples produced at the logged step.
+	MediaIDs []int `json:"mediaIDs,omitempty"`
+
+	// Media contains the attached media records which
+	// still exist on the server.
+	// It is set by the server and ignored when adding
+	// records.
+	Media []MediaRecord `json:"media,omitempty"`
+
+	// MaxLevel is only set for records in an overview.
+	// It is the highest level among the service's recent
+	// records.
+	MaxLevel Level `json:"maxLevel,omitempty"`
+
+	// Info is only set for records in an overview.
+	// It is the JSON document attached to the service
+	// with SetServiceInfo, if there is one.
+	Info json.RawMessage `json:"info,omitempty"`
+
+	// Progress is only set for records in an overview or a
+	// stream.
+	// It is the latest progress of the service, if the
+	// service has reported any with SetProgress.
+	Progress *Progress `json:"progress,omitempty"`
+
+	// Update is only set for records in a stream.
+	// It is true if the record was already sent, and it is
+	// being sent again because the progress of its service
+	// changed.
+	Update bool `json:"update,omitempty"`
+}
+
+// An Entry is a message to add to a service's log, along
+// with optional metadata.
+type Entry struct {
+	Message  string `json:"message"`
+	Level    Level  `json:"level,omitempty"`
+	Labels   Labels `json:"labels,omitempty"`
+	MediaIDs []int  `json:"mediaIDs,omitempty"`
 }
 
 // A MediaRecord is a piece of media stored on the server.
@@ -36,12 +92,71 @@ type MediaRecord struct {
 	Mime     string `json:"mime"`
 	Time     int64  `json:"time"`
 	ID       int    `json:"id"`
+
+	// Size is the number of bytes in the media.
+	Size int64 `json:"size"`
+
+	// Width and Height are the dimensions of PNG, JPEG,
+	// and GIF images.
+	// They are 0 for other kinds of media.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+
+	// Version counts the records which have been added to
+	// the folder with the same filename, starting at 1.
+	Version int `json:"version,omitempty"`
+
+	// SHA256 is the hex-encoded SHA-256 hash of the media.
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Replaced is true if a newer version of the file was
+	// added with replace set.
+	// Replaced records are not listed in media logs, but
+	// they are still available as older versions.
+	Replaced bool `json:"replaced,omitempty"`
+}
+
+// MediaChunkSize is the maximum number of bytes sent per
+// request when uploading media.
+const MediaChunkSize = 8 << 20
+
+// DefaultTimeout is the default time limit for a single
+// API request, not including streams.
+const DefaultTimeout = time.Minute
+
+// Prefs stores the server's settings.
+type Prefs struct {
+	// LogSize is the maximum number of log records to keep
+	// per service.
+	LogSize int `json:"logSize"`
+
+	// MediaCache is the soft limit on the number of bytes
+	// to keep per media folder.
+	MediaCache int `json:"mediaCache"`
+
+	// MediaQuota is the limit on the number of bytes of
+	// media stored across all folders, or 0 for no limit.
+	// Identical media contents are only counted once.
+	MediaQuota int64 `json:"mediaQuota"`
 }
 
 // A Client interfaces with a StatusHub back-end.
+//
+// Every method has a variant ending in Context which
+// takes a context.Context to control cancellation.
+// Idempotent calls are retried according to the client's
+// RetryPolicy.
+//
+// After a successful Login, the client remembers the
+// password so that it can log in again automatically if
+// the session expires.
 type Client struct {
 	c       *http.Client
 	rootURL url.URL
+	retry   RetryPolicy
+
+	passLock sync.RWMutex
+	password *string
 }
 
 // NewClient creates a new, unauthenticated client.
@@ -60,24 +175,82 @@ func NewClient(rootURL string) (*Client, error) {
 	}
 	return &Client{
 		c: &http.Client{
-			Jar: j,
+			Jar:     j,
+			Timeout: DefaultTimeout,
 		},
 		rootURL: *u,
+		retry:   DefaultRetryPolicy,
 	}, nil
 }
 
+// SetTimeout sets the time limit for each API request.
+// A timeout of 0 means no timeout.
+//
+// This should not be called concurrently with other
+// methods.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	c.c.Timeout = timeout
+}
+
+// SetRetryPolicy sets the policy for retrying idempotent
+// API calls.
+//
+// This should not be called concurrently with other
+// methods.
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	c.retry = policy
+}
+
 // Login attempts to authenticate with the server.
 func (c *Client) Login(password string) error {
+	return c.LoginContext(context.Background(), password)
+}
+
+// LoginContext is like Login with a context.
+func (c *Client) LoginContext(ctx context.Context, password string) error {
+	if err := c.login(ctx, password); err != nil {
+		return err
+	}
+	c.passLock.Lock()
+	c.password = &password
+	c.passLock.Unlock()
+	return nil
+}
+
+// relogin attempts to log in again with the remembered
+// password.
+//
+// It returns false if there is no remembered password or
+// if the login fails.
+func (c *Client) relogin(ctx context.Context) bool {
+	c.passLock.RLock()
+	password := c.password
+	c.passLock.RUnlock()
+	if password == nil {
+		return false
+	}
+	return c.login(ctx, *password) == nil
+}
+
+func (c *Client) login(ctx context.Context, password string) error {
 	u := c.rootURL
 	u.Path = "/login"
 	query := bytes.NewReader([]byte("password=" + url.QueryEscape(password)))
-	res, err := c.c.Post(u.String(), "application/x-www-form-urlencoded", query)
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), query)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := c.c.Do(req)
 	if res != nil {
 		res.Body.Close()
 	}
 	if err != nil {
 		return err
 	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		return &RemoteError{Code: CodeRateLimited, Message: "too many login attempts"}
+	}
 	if res.Request.URL.Path == u.Path {
 		return errors.New("login failed")
 	}
@@ -85,13 +258,33 @@ func (c *Client) Login(password string) error {
 }
 
 // Add adds a log record and returns its ID.
+//
+// The request carries a random idempotency key, so it is
+// retried on transient errors without risking duplicate
+// records.
 func (c *Client) Add(service, message string) (int, error) {
+	return c.AddContext(context.Background(), service, message)
+}
+
+// AddContext is like Add with a context.
+func (c *Client) AddContext(ctx context.Context, service, message string) (int, error) {
+	return c.AddKeyContext(ctx, service, NewIdempotencyKey(), message)
+}
+
+// AddKeyContext is like AddContext, but with an explicit
+// idempotency key.
+//
+// If the server has recently seen the key for the same
+// service, it returns the original ID instead of adding
+// another record.
+func (c *Client) AddKeyContext(ctx context.Context, service, key, message string) (int, error) {
 	msg := map[string]string{
 		"service": service,
 		"message": message,
+		"key":     key,
 	}
 	var resID int
-	err := c.apiCall("add", msg, &resID)
+	err := c.idempotentCall(ctx, "add", msg, &resID)
 	if err != nil {
 		err = essentials.AddCtx("add log record", err)
 	}
@@ -100,13 +293,56 @@ func (c *Client) Add(service, message string) (int, error) {
 
 // AddBatch adds a batch of log records and returns their
 // IDs.
+//
+// Like Add, the request carries a random idempotency key.
 func (c *Client) AddBatch(service string, messages []string) ([]int, error) {
+	return c.AddBatchContext(context.Background(), service, messages)
+}
+
+// AddBatchContext is like AddBatch with a context.
+func (c *Client) AddBatchContext(ctx context.Context, service string,
+	messages []string) ([]int, error) {
+	return c.AddBatchKeyContext(ctx, service, NewIdempotencyKey(), messages)
+}
+
+// AddBatchKeyContext is like AddBatchContext, but with an
+// explicit idempotency key for the batch.
+//
+// If the server has recently seen the key for the same
+// service, it returns the original IDs instead of adding
+// the batch again.
+func (c *Client) AddBatchKeyContext(ctx context.Context, service, key string,
+	messages []string) ([]int, error) {
+	entries := make([]Entry, len(messages))
+	for i, message := range messages {
+		entries[i].Message = message
+	}
+	return c.AddEntriesKeyContext(ctx, service, key, entries)
+}
+
+// AddEntries is like AddBatch, but each message may have
+// metadata such as a level.
+func (c *Client) AddEntries(service string, entries []Entry) ([]int, error) {
+	return c.AddEntriesContext(context.Background(), service, entries)
+}
+
+// AddEntriesContext is like AddEntries with a context.
+func (c *Client) AddEntriesContext(ctx context.Context, service string,
+	entries []Entry) ([]int, error) {
+	return c.AddEntriesKeyContext(ctx, service, NewIdempotencyKey(), entries)
+}
+
+// AddEntriesKeyContext is like AddEntriesContext, but with
+// an explicit idempotency key for the batch.
+func (c *Client) AddEntriesKeyContext(ctx context.Context, service, key string,
+	entries []Entry) ([]int, error) {
 	msg := map[string]interface{}{
-		"service":  service,
-		"messages": messages,
+		"service": service,
+		"entries": entries,
+		"key":     key,
 	}
 	var resIDs []int
-	err := c.apiCall("addBatch", msg, &resIDs)
+	err := c.idempotentCall(ctx, "addBatch", msg, &resIDs)
 	if err != nil {
 		err = essentials.AddCtx("add log records", err)
 	}
@@ -114,60 +350,635 @@ func (c *Client) AddBatch(service string, messages []string) ([]int, error) {
 }
 
 // AddMedia adds a media record and returns its ID.
+//
+// If replace is true, older versions of the file are
+// marked as replaced, hiding them from the media log.
 func (c *Client) AddMedia(folder, filename, mime string, data []byte, replace bool) (int, error) {
-	msg := map[string]interface{}{
-		"folder":   folder,
-		"filename": filename,
-		"mime":     mime,
-		"data":     data,
-		"replace":  replace,
+	return c.AddMediaContext(context.Background(), folder, filename, mime, data, replace)
+}
+
+// AddMediaContext is like AddMedia with a context.
+func (c *Client) AddMediaContext(ctx context.Context, folder, filename, mime string,
+	data []byte, replace bool) (int, error) {
+	return c.AddMediaReaderContext(ctx, folder, filename, mime, bytes.NewReader(data),
+		int64(len(data)), replace)
+}
+
+// AddMediaReader adds a media record with the contents of
+// a reader and returns its ID.
+//
+// The server verifies the upload against a SHA-256 hash
+// computed by the client.
+//
+// The size is the number of bytes in the reader, or -1 if
+// it is unknown.
+// Large or unknown-size contents are uploaded in chunks of
+// MediaChunkSize bytes, and chunks which fail due to
+// transient errors are retried according to the retry
+// policy.
+func (c *Client) AddMediaReader(folder, filename, mime string, r io.Reader, size int64,
+	replace bool) (int, error) {
+	return c.AddMediaReaderContext(context.Background(), folder, filename, mime, r, size,
+		replace)
+}
+
+// AddMediaReaderContext is like AddMediaReader with a
+// context.
+func (c *Client) AddMediaReaderContext(ctx context.Context, folder, filename, mime string,
+	r io.Reader, size int64, replace bool) (int, error) {
+	return c.AddLinkedMediaReaderContext(ctx, "", folder, filename, mime, r, size, replace)
+}
+
+// AddLinkedMedia is like AddMedia, but it also adds a log
+// record to a service which links to the media.
+//
+// The log record's message is MediaMessage(folder,
+// filename).
+// If service is empty, no log record is added.
+func (c *Client) AddLinkedMedia(service, folder, filename, mime string, data []byte,
+	replace bool) (int, error) {
+	return c.AddLinkedMediaContext(context.Background(), service, folder, filename, mime, data,
+		replace)
+}
+
+// AddLinkedMediaContext is like AddLinkedMedia with a
+// context.
+func (c *Client) AddLinkedMediaContext(ctx context.Context, service, folder, filename,
+	mime string, data []byte, replace bool) (int, error) {
+	return c.AddLinkedMediaReaderContext(ctx, service, folder, filename, mime,
+		bytes.NewReader(data), int64(len(data)), replace)
+}
+
+// AddLinkedMediaReader is like AddMediaReader, but it also
+// adds a log record to a service which links to the media,
+// like AddLinkedMedia.
+func (c *Client) AddLinkedMediaReader(service, folder, filename, mime string, r io.Reader,
+	size int64, replace bool) (int, error) {
+	return c.AddLinkedMediaReaderContext(context.Background(), service, folder, filename, mime,
+		r, size, replace)
+}
+
+// AddLinkedMediaReaderContext is like AddLinkedMediaReader
+// with a context.
+func (c *Client) AddLinkedMediaReaderContext(ctx context.Context, service, folder, filename,
+	mime string, r io.Reader, size int64, replace bool) (int, error) {
+	info := &mediaUpload{
+		Service:  service,
+		Folder:   folder,
+		Filename: filename,
+		Mime:     mime,
+		Replace:  replace,
+	}
+	var id int
+	var err error
+	if size >= 0 && size <= MediaChunkSize {
+		id, err = c.uploadMedia(ctx, info, r, size)
+	} else {
+		id, err = c.uploadMediaChunks(ctx, info, r, size)
 	}
-	var resID int
-	err := c.apiCall("addMedia", msg, &resID)
 	if err != nil {
-		err = essentials.AddCtx("add media record", err)
+		return 0, essentials.AddCtx("add media record", err)
 	}
-	return resID, err
+	return id, nil
 }
 
 // Overview returns the most recent log message from every
 // service.
+//
+// Each record's MaxLevel field is set to the highest level
+// the service has logged recently.
 func (c *Client) Overview() ([]LogRecord, error) {
-	msg := map[string]string{}
+	return c.OverviewContext(context.Background())
+}
+
+// OverviewContext is like Overview with a context.
+func (c *Client) OverviewContext(ctx context.Context) ([]LogRecord, error) {
+	return c.OverviewFilterContext(ctx, nil)
+}
+
+// OverviewFilterContext is like OverviewContext, but it
+// only returns records which match a filter.
+func (c *Client) OverviewFilterContext(ctx context.Context, filter *LogFilter) ([]LogRecord,
+	error) {
+	msg := map[string]interface{}{"filter": filter}
 	var reply []LogRecord
-	if err := c.apiCall("overview", msg, &reply); err != nil {
+	if err := c.idempotentCall(ctx, "overview", msg, &reply); err != nil {
 		return nil, essentials.AddCtx("fetch overview", err)
 	}
 	return reply, nil
 }
 
+// GroupOverview returns an overview of the namespaces one
+// level below a parent namespace.
+// The empty parent lists the top-level namespaces.
+func (c *Client) GroupOverview(parent string) ([]ServiceGroup, error) {
+	return c.GroupOverviewContext(context.Background(), parent)
+}
+
+// GroupOverviewContext is like GroupOverview with a
+// context.
+func (c *Client) GroupOverviewContext(ctx context.Context, parent string) ([]ServiceGroup,
+	error) {
+	msg := map[string]string{"parent": parent}
+	var reply []ServiceGroup
+	if err := c.idempotentCall(ctx, "groupOverview", msg, &reply); err != nil {
+		return nil, essentials.AddCtx("fetch group overview", err)
+	}
+	return reply, nil
+}
+
+// ServiceLabels returns the labels of a service.
+func (c *Client) ServiceLabels(service string) (Labels, error) {
+	return c.ServiceLabelsContext(context.Background(), service)
+}
+
+// ServiceLabelsContext is like ServiceLabels with a
+// context.
+func (c *Client) ServiceLabelsContext(ctx context.Context, service string) (Labels, error) {
+	msg := map[string]string{"service": service}
+	var reply Labels
+	if err := c.idempotentCall(ctx, "serviceLabels", msg, &reply); err != nil {
+		return nil, essentials.AddCtx("fetch service labels", err)
+	}
+	return reply, nil
+}
+
+// SetServiceLabels replaces the labels of a service.
+//
+// Service labels are included in the labels of every
+// record from the service, so they can be used to filter
+// records.
+func (c *Client) SetServiceLabels(service string, labels Labels) error {
+	return c.SetServiceLabelsContext(context.Background(), service, labels)
+}
+
+// SetServiceLabelsContext is like SetServiceLabels with a
+// context.
+func (c *Client) SetServiceLabelsContext(ctx context.Context, service string,
+	labels Labels) error {
+	msg := map[string]interface{}{"service": service, "labels": labels}
+	var result bool
+	err := c.idempotentCall(ctx, "setServiceLabels", msg, &result)
+	return essentials.AddCtx("set service labels", err)
+}
+
 // ServiceLog returns the log records for a service,
 // sorted by most to least recent.
 // It returns with an error if the service does not exist.
 func (c *Client) ServiceLog(service string) ([]LogRecord, error) {
-	msg := map[string]string{"service": service}
+	return c.ServiceLogContext(context.Background(), service)
+}
+
+// ServiceLogContext is like ServiceLog with a context.
+func (c *Client) ServiceLogContext(ctx context.Context, service string) ([]LogRecord, error) {
+	return c.ServiceLogFilterContext(ctx, service, nil)
+}
+
+// ServiceLogFilterContext is like ServiceLogContext, but
+// only returns records which match a filter.
+func (c *Client) ServiceLogFilterContext(ctx context.Context, service string,
+	filter *LogFilter) ([]LogRecord, error) {
+	msg := map[string]interface{}{"service": service, "filter": filter}
 	var reply []LogRecord
-	if err := c.apiCall("serviceLog", msg, &reply); err != nil {
+	if err := c.idempotentCall(ctx, "serviceLog", msg, &reply); err != nil {
 		return nil, essentials.AddCtx("fetch service log", err)
 	}
 	return reply, nil
 }
 
+// FullLog returns the log records for every service,
+// sorted by most to least recent.
+func (c *Client) FullLog() ([]LogRecord, error) {
+	return c.FullLogContext(context.Background())
+}
+
+// FullLogContext is like FullLog with a context.
+func (c *Client) FullLogContext(ctx context.Context) ([]LogRecord, error) {
+	return c.FullLogFilterContext(ctx, nil)
+}
+
+// FullLogFilterContext is like FullLogContext, but only
+// returns records which match a filter.
+func (c *Client) FullLogFilterContext(ctx context.Context, filter *LogFilter) ([]LogRecord,
+	error) {
+	msg := map[string]interface{}{"filter": filter}
+	var reply []LogRecord
+	if err := c.idempotentCall(ctx, "fullLog", msg, &reply); err != nil {
+		return nil, essentials.AddCtx("fetch full log", err)
+	}
+	return reply, nil
+}
+
+// ServiceInfo returns the JSON document attached to a
+// service with SetServiceInfo.
+//
+// The result is nil if the service has no info.
+func (c *Client) ServiceInfo(service string) (json.RawMessage, error) {
+	return c.ServiceInfoContext(context.Background(), service)
+}
+
+// ServiceInfoContext is like ServiceInfo with a context.
+func (c *Client) ServiceInfoContext(ctx context.Context, service string) (json.RawMessage,
+	error) {
+	msg := map[string]string{"service": service}
+	var reply json.RawMessage
+	if err := c.idempotentCall(ctx, "serviceInfo", msg, &reply); err != nil {
+		return nil, essentials.AddCtx("fetch service info", err)
+	}
+	if string(reply) == "null" {
+		return nil, nil
+	}
+	return reply, nil
+}
+
+// SetServiceInfo attaches a JSON document, such as a run
+// configuration, to a service.
+// The info is encoded with json.Marshal and replaces any
+// previous info for the service.
+// A nil info removes the service's info.
+//
+// The service does not have to exist yet.
+func (c *Client) SetServiceInfo(service string, info interface{}) error {
+	return c.SetServiceInfoContext(context.Background(), service, info)
+}
+
+// SetServiceInfoContext is like SetServiceInfo with a
+// context.
+func (c *Client) SetServiceInfoContext(ctx context.Context, service string,
+	info interface{}) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return essentials.AddCtx("set service info", err)
+	}
+	msg := map[string]interface{}{"service": service, "info": json.RawMessage(data)}
+	var result bool
+	err = c.idempotentCall(ctx, "setServiceInfo", msg, &result)
+	return essentials.AddCtx("set service info", err)
+}
+
+// SetProgress reports how much of a service's work is
+// done, e.g. the current step out of the total number of
+// steps.
+//
+// The server estimates a rate and an ETA from the recent
+// progress updates of each service.
+func (c *Client) SetProgress(service string, done, total float64) error {
+	return c.SetProgressContext(context.Background(), service, done, total)
+}
+
+// SetProgressContext is like SetProgress with a context.
+func (c *Client) SetProgressContext(ctx context.Context, service string, done,
+	total float64) error {
+	msg := map[string]interface{}{"service": service, "done": done, "total": total}
+	var result bool
+	err := c.idempotentCall(ctx, "setProgress", msg, &result)
+	return essentials.AddCtx("set progress", err)
+}
+
+// Compare compares the numeric "key=value" fields in the
+// logs of multiple services.
+//
+// The opts argument may be nil to use default options.
+func (c *Client) Compare(services []string, opts *CompareOptions) (*RunComparison, error) {
+	return c.CompareContext(context.Background(), services, opts)
+}
+
+// CompareContext is like Compare with a context.
+func (c *Client) CompareContext(ctx context.Context, services []string,
+	opts *CompareOptions) (*RunComparison, error) {
+	msg := map[string]interface{}{"services": services, "options": opts}
+	var reply RunComparison
+	if err := c.idempotentCall(ctx, "compare", msg, &reply); err != nil {
+		return nil, essentials.AddCtx("compare services", err)
+	}
+	return &reply, nil
+}
+
+// MediaOverview returns the most recent media record from
+// every folder.
+func (c *Client) MediaOverview() ([]MediaRecord, error) {
+	return c.MediaOverviewContext(context.Background())
+}
+
+// MediaOverviewContext is like MediaOverview with a
+// context.
+func (c *Client) MediaOverviewContext(ctx context.Context) ([]MediaRecord, error) {
+	msg := map[string]string{}
+	var reply []MediaRecord
+	if err := c.idempotentCall(ctx, "mediaOverview", msg, &reply); err != nil {
+		return nil, essentials.AddCtx("fetch media overview", err)
+	}
+	return reply, nil
+}
+
+// MediaLog returns the media records for a folder, sorted
+// by most to least recent.
+// Replaced records are omitted; see MediaVersions.
+// It returns with an error if the folder does not exist.
+func (c *Client) MediaLog(folder string) ([]MediaRecord, error) {
+	return c.MediaLogContext(context.Background(), folder)
+}
+
+// MediaLogContext is like MediaLog with a context.
+func (c *Client) MediaLogContext(ctx context.Context, folder string) ([]MediaRecord, error) {
+	msg := map[string]string{"folder": folder}
+	var reply []MediaRecord
+	if err := c.idempotentCall(ctx, "mediaLog", msg, &reply); err != nil {
+		return nil, essentials.AddCtx("fetch media log", err)
+	}
+	return reply, nil
+}
+
+// MediaVersions returns the versions of a file in a media
+// folder, sorted by most to least recent.
+// It returns with an error if there are no such versions.
+func (c *Client) MediaVersions(folder, filename string) ([]MediaRecord, error) {
+	return c.MediaVersionsContext(context.Background(), folder, filename)
+}
+
+// MediaVersionsContext is like MediaVersions with a
+// context.
+func (c *Client) MediaVersionsContext(ctx context.Context, folder,
+	filename string) ([]MediaRecord, error) {
+	msg := map[string]string{"folder": folder, "filename": filename}
+	var reply []MediaRecord
+	if err := c.idempotentCall(ctx, "mediaVersions", msg, &reply); err != nil {
+		return nil, essentials.AddCtx("fetch media versions", err)
+	}
+	return reply, nil
+}
+
+// MediaVersion looks up a version of a file in a media
+// folder.
+// If version is 0, the latest version is returned.
+//
+// The contents can be downloaded with MediaView.
+func (c *Client) MediaVersion(folder, filename string, version int) (*MediaRecord, error) {
+	return c.MediaVersionContext(context.Background(), folder, filename, version)
+}
+
+// MediaVersionContext is like MediaVersion with a context.
+func (c *Client) MediaVersionContext(ctx context.Context, folder, filename string,
+	version int) (*MediaRecord, error) {
+	msg := map[string]interface{}{"folder": folder, "filename": filename, "version": version}
+	var reply MediaRecord
+	if err := c.idempotentCall(ctx, "mediaVersion", msg, &reply); err != nil {
+		return nil, essentials.AddCtx("fetch media version", err)
+	}
+	return &reply, nil
+}
+
+// MediaView downloads the contents of a media record and
+// writes them to w.
+func (c *Client) MediaView(id int, w io.Writer) error {
+	return c.MediaViewContext(context.Background(), id, w)
+}
+
+// MediaViewContext is like MediaView with a context.
+func (c *Client) MediaViewContext(ctx context.Context, id int, w io.Writer) error {
+	query := url.Values{}
+	query.Set("id", strconv.Itoa(id))
+	if err := c.download(ctx, "mediaView", query, w); err != nil {
+		return essentials.AddCtx("view media", err)
+	}
+	return nil
+}
+
+// MediaThumb downloads a thumbnail of an image media
+// record and writes it to w.
+//
+// The thumbnail fits in a size by size square.
+// If size is 0, the server's default size is used.
+func (c *Client) MediaThumb(id, size int, w io.Writer) error {
+	return c.MediaThumbContext(context.Background(), id, size, w)
+}
+
+// MediaThumbContext is like MediaThumb with a context.
+func (c *Client) MediaThumbContext(ctx context.Context, id, size int, w io.Writer) error {
+	query := url.Values{}
+	query.Set("id", strconv.Itoa(id))
+	if size != 0 {
+		query.Set("size", strconv.Itoa(size))
+	}
+	if err := c.download(ctx, "mediaThumb", query, w); err != nil {
+		return essentials.AddCtx("fetch thumbnail", err)
+	}
+	return nil
+}
+
+// MediaDiff compares two media records and writes the
+// result to w.
+//
+// Text records produce a unified diff.
+// Image records produce a PNG image of the per-pixel
+// differences, or of the two images next to each other if
+// mode is "side".
+// An empty mode uses the default, "diff".
+func (c *Client) MediaDiff(a, b int, mode string, w io.Writer) error {
+	return c.MediaDiffContext(context.Background(), a, b, mode, w)
+}
+
+// MediaDiffContext is like MediaDiff with a context.
+func (c *Client) MediaDiffContext(ctx context.Context, a, b int, mode string,
+	w io.Writer) error {
+	query := url.Values{}
+	query.Set("a", strconv.Itoa(a))
+	query.Set("b", strconv.Itoa(b))
+	if mode != "" {
+		query.Set("mode", mode)
+	}
+	if err := c.download(ctx, "mediaDiff", query, w); err != nil {
+		return essentials.AddCtx("diff media", err)
+	}
+	return nil
+}
+
+// download performs a GET API call with retries and copies
+// the response to w.
+func (c *Client) download(ctx context.Context, name string, query url.Values,
+	w io.Writer) error {
+	var body io.ReadCloser
+	err := c.retry.Retry(ctx, func() error {
+		var err error
+		body, err = c.getCall(ctx, name, query)
+		if errors.Is(err, ErrNotAuthenticated) && c.relogin(ctx) {
+			body, err = c.getCall(ctx, name, query)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	_, err = io.Copy(w, body)
+	return err
+}
+
+// Export downloads an archive of every service, record,
+// and media record on the server and writes it to w.
+//
+// The archive format is described by ArchiveVersion.
+func (c *Client) Export(w io.Writer) error {
+	return c.ExportContext(context.Background(), w)
+}
+
+// ExportContext is like Export with a context.
+func (c *Client) ExportContext(ctx context.Context, w io.Writer) error {
+	return essentials.AddCtx("export", c.download(ctx, "export", nil, w))
+}
+
+// Import uploads an archive created by Export.
+func (c *Client) Import(r io.Reader, opts ImportOptions) (*ImportStats, error) {
+	return c.ImportContext(context.Background(), r, opts)
+}
+
+// ImportContext is like Import with a context.
+func (c *Client) ImportContext(ctx context.Context, r io.Reader,
+	opts ImportOptions) (*ImportStats, error) {
+	query := url.Values{}
+	if opts.Replace {
+		query.Set("replace", "1")
+	}
+	if opts.RemapIDs {
+		query.Set("remap", "1")
+	}
+	var stats ImportStats
+	err := c.postCall(ctx, "import", query, "application/x-tar", r, &stats)
+	if err != nil {
+		return nil, essentials.AddCtx("import", err)
+	}
+	return &stats, nil
+}
+
+// DeleteMedia deletes a media folder.
+func (c *Client) DeleteMedia(folder string) error {
+	return c.DeleteMediaContext(context.Background(), folder)
+}
+
+// DeleteMediaContext is like DeleteMedia with a context.
+func (c *Client) DeleteMediaContext(ctx context.Context, folder string) error {
+	msg := map[string]string{"folder": folder}
+	var result bool
+	err := c.apiCall(ctx, "deleteMedia", msg, &result)
+	return essentials.AddCtx("delete media folder", err)
+}
+
+// GetPrefs fetches the server's settings.
+func (c *Client) GetPrefs() (*Prefs, error) {
+	return c.GetPrefsContext(context.Background())
+}
+
+// GetPrefsContext is like GetPrefs with a context.
+func (c *Client) GetPrefsContext(ctx context.Context) (*Prefs, error) {
+	msg := map[string]string{}
+	var reply Prefs
+	if err := c.idempotentCall(ctx, "getprefs", msg, &reply); err != nil {
+		return nil, essentials.AddCtx("get preferences", err)
+	}
+	return &reply, nil
+}
+
+// SetPrefs updates the server's settings.
+func (c *Client) SetPrefs(prefs *Prefs) error {
+	return c.SetPrefsContext(context.Background(), prefs)
+}
+
+// SetPrefsContext is like SetPrefs with a context.
+func (c *Client) SetPrefsContext(ctx context.Context, prefs *Prefs) error {
+	var result bool
+	err := c.idempotentCall(ctx, "setprefs", prefs, &result)
+	return essentials.AddCtx("set preferences", err)
+}
+
+// ChangePassword changes the server's password.
+//
+// On success, the client uses the new password if it has
+// to log in again.
+func (c *Client) ChangePassword(oldPass, newPass string) error {
+	return c.ChangePasswordContext(context.Background(), oldPass, newPass)
+}
+
+// ChangePasswordContext is like ChangePassword with a
+// context.
+func (c *Client) ChangePasswordContext(ctx context.Context, oldPass, newPass string) error {
+	msg := map[string]string{
+		"old":     oldPass,
+		"confirm": newPass,
+		"new":     newPass,
+	}
+	var result bool
+	if err := c.apiCall(ctx, "chpass", msg, &result); err != nil {
+		return essentials.AddCtx("change password", err)
+	}
+	c.passLock.Lock()
+	if c.password != nil {
+		c.password = &newPass
+	}
+	c.passLock.Unlock()
+	return nil
+}
+
 // Delete deletes the log for a service.
 func (c *Client) Delete(service string) error {
+	return c.DeleteContext(context.Background(), service)
+}
+
+// DeleteContext is like Delete with a context.
+func (c *Client) DeleteContext(ctx context.Context, service string) error {
 	msg := map[string]string{"service": service}
 	var result bool
-	err := c.apiCall("delete", msg, &result)
+	err := c.apiCall(ctx, "delete", msg, &result)
 	return essentials.AddCtx("delete service log", err)
 }
 
+// DeleteNamespace deletes every service in a namespace
+// and returns the names of the deleted services.
+//
+// If confirm is false, nothing is deleted, and the result
+// lists the services which would be deleted.
+func (c *Client) DeleteNamespace(namespace string, confirm bool) ([]string, error) {
+	return c.DeleteNamespaceContext(context.Background(), namespace, confirm)
+}
+
+// DeleteNamespaceContext is like DeleteNamespace with a
+// context.
+func (c *Client) DeleteNamespaceContext(ctx context.Context, namespace string,
+	confirm bool) ([]string, error) {
+	msg := map[string]interface{}{"namespace": namespace, "confirm": confirm}
+	var reply []string
+	if err := c.apiCall(ctx, "deleteNamespace", msg, &reply); err != nil {
+		return nil, essentials.AddCtx("delete namespace", err)
+	}
+	return reply, nil
+}
+
 // FullStream creates a channel of live log messages.
 // The cancel chan can be closed to tell the stream to
 // terminate.
 // The returned channels will be closed on error or after
 // a graceful shutdown.
 func (c *Client) FullStream(cancel <-chan struct{}) (<-chan LogRecord, <-chan error) {
-	return c.streamCall(cancel, "/api/fullStream", "")
+	return c.streamCall(context.Background(), cancel, "/api/fullStream", "")
+}
+
+// FullStreamContext is like FullStream, but the stream is
+// terminated when the context is done.
+func (c *Client) FullStreamContext(ctx context.Context) (<-chan LogRecord, <-chan error) {
+	return c.FullStreamFilterContext(ctx, nil)
+}
+
+// FullStreamFilterContext is like FullStreamContext, but
+// only streams records which match a filter.
+func (c *Client) FullStreamFilterContext(ctx context.Context,
+	filter *LogFilter) (<-chan LogRecord, <-chan error) {
+	return c.streamCall(ctx, nil, "/api/fullStream", filter.Query().Encode())
+}
+
+// NamespaceStreamContext is like FullStreamContext, but it
+// limits messages to services in a namespace.
+func (c *Client) NamespaceStreamContext(ctx context.Context,
+	namespace string) (<-chan LogRecord, <-chan error) {
+	return c.FullStreamFilterContext(ctx, &LogFilter{Namespace: namespace})
 }
 
 // ServiceStream is like FullStream, but it limits
@@ -175,17 +986,174 @@ func (c *Client) FullStream(cancel <-chan struct{}) (<-chan LogRecord, <-chan er
 func (c *Client) ServiceStream(service string, cancel <-chan struct{}) (<-chan LogRecord,
 	<-chan error) {
 	escaped := url.QueryEscape(service)
-	return c.streamCall(cancel, "/api/serviceStream", "service="+escaped)
+	return c.streamCall(context.Background(), cancel, "/api/serviceStream", "service="+escaped)
 }
 
-func (c *Client) apiCall(name string, msg, reply interface{}) error {
+// ServiceStreamContext is like ServiceStream, but the
+// stream is terminated when the context is done.
+func (c *Client) ServiceStreamContext(ctx context.Context, service string) (<-chan LogRecord,
+	<-chan error) {
+	return c.ServiceStreamFilterContext(ctx, service, nil)
+}
+
+// ServiceStreamFilterContext is like ServiceStreamContext,
+// but only streams records which match a filter.
+func (c *Client) ServiceStreamFilterContext(ctx context.Context, service string,
+	filter *LogFilter) (<-chan LogRecord, <-chan error) {
+	query := filter.Query()
+	query.Set("service", service)
+	return c.streamCall(ctx, nil, "/api/serviceStream", query.Encode())
+}
+
+// mediaUpload describes a media record being uploaded.
+type mediaUpload struct {
+	Service  string
+	Folder   string
+	Filename string
+	Mime     string
+	Replace  bool
+}
+
+// uploadMedia uploads small media in a single request.
+func (c *Client) uploadMedia(ctx context.Context, info *mediaUpload, r io.Reader,
+	size int64) (int, error) {
+	// Buffering the data allows us to log in again and
+	// retry if the session has expired.
+	data, err := ioutil.ReadAll(io.LimitReader(r, size+1))
+	if err != nil {
+		return 0, err
+	} else if int64(len(data)) != size {
+		return 0, fmt.Errorf("expected %d bytes but read %d", size, len(data))
+	}
+	hash := sha256.Sum256(data)
+	query := url.Values{}
+	query.Set("sha256", hex.EncodeToString(hash[:]))
+	query.Set("folder", info.Folder)
+	query.Set("filename", info.Filename)
+	query.Set("mime", info.Mime)
+	if info.Replace {
+		query.Set("replace", "1")
+	}
+	if info.Service != "" {
+		query.Set("service", info.Service)
+	}
+	var id int
+	call := func() error {
+		return c.postCall(ctx, "uploadMedia", query, "application/octet-stream",
+			bytes.NewReader(data), &id)
+	}
+	err = call()
+	if errors.Is(err, ErrNotAuthenticated) && c.relogin(ctx) {
+		err = call()
+	}
+	return id, err
+}
+
+// uploadMediaChunks uploads media in chunks.
+func (c *Client) uploadMediaChunks(ctx context.Context, info *mediaUpload, r io.Reader,
+	size int64) (id int, err error) {
+	var upload string
+	if err := c.apiCall(ctx, "startUpload", nil, &upload); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			var result bool
+			c.apiCall(context.Background(), "cancelUpload",
+				map[string]string{"upload": upload}, &result)
+		}
+	}()
+
+	hasher := sha256.New()
+	buf := make([]byte, MediaChunkSize)
+	var offset int64
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			hasher.Write(buf[:n])
+			query := url.Values{}
+			query.Set("upload", upload)
+			query.Set("offset", strconv.FormatInt(offset, 10))
+			var newSize int64
+			err := c.retry.Retry(ctx, func() error {
+				err := c.postCall(ctx, "uploadChunk", query, "application/octet-stream",
+					bytes.NewReader(buf[:n]), &newSize)
+				if errors.Is(err, ErrNotAuthenticated) && c.relogin(ctx) {
+					err = c.postCall(ctx, "uploadChunk", query, "application/octet-stream",
+						bytes.NewReader(buf[:n]), &newSize)
+				}
+				return err
+			})
+			if err != nil {
+				return 0, err
+			}
+			offset += int64(n)
+			if newSize != offset {
+				return 0, fmt.Errorf("server has %d bytes but %d were sent", newSize, offset)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		} else if readErr != nil {
+			return 0, readErr
+		}
+	}
+
+	msg := map[string]interface{}{
+		"upload":   upload,
+		"service":  info.Service,
+		"folder":   info.Folder,
+		"filename": info.Filename,
+		"mime":     info.Mime,
+		"replace":  info.Replace,
+		"sha256":   hex.EncodeToString(hasher.Sum(nil)),
+	}
+	if size >= 0 {
+		msg["size"] = size
+	}
+	err = c.apiCall(ctx, "finishUpload", msg, &id)
+	return id, err
+}
+
+// idempotentCall is like apiCall, but it retries the call
+// according to the retry policy.
+func (c *Client) idempotentCall(ctx context.Context, name string, msg, reply interface{}) error {
+	return c.retry.Retry(ctx, func() error {
+		return c.apiCall(ctx, name, msg, reply)
+	})
+}
+
+// apiCall makes an API call, logging in again and
+// retrying once if the session has expired.
+func (c *Client) apiCall(ctx context.Context, name string, msg, reply interface{}) error {
+	err := c.rawAPICall(ctx, name, msg, reply)
+	if errors.Is(err, ErrNotAuthenticated) && c.relogin(ctx) {
+		err = c.rawAPICall(ctx, name, msg, reply)
+	}
+	return err
+}
+
+func (c *Client) rawAPICall(ctx context.Context, name string, msg, reply interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.postCall(ctx, name, nil, "application/json", bytes.NewReader(body), reply)
+}
+
+// postCall makes a POST request with an arbitrary body to
+// an API which responds with JSON.
+func (c *Client) postCall(ctx context.Context, name string, query url.Values,
+	contentType string, body io.Reader, reply interface{}) error {
 	u := c.rootURL
 	u.Path = "/api/" + name
-	query, err := json.Marshal(msg)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), body)
 	if err != nil {
 		return err
 	}
-	res, err := c.c.Post(u.String(), "application/json", bytes.NewReader(query))
+	req.Header.Set("Content-Type", contentType)
+	res, err := c.c.Do(req)
 	if res != nil {
 		defer res.Body.Close()
 	}
@@ -199,13 +1167,17 @@ func (c *Client) apiCall(name string, msg, reply interface{}) error {
 	var respObj struct {
 		Data  interface{} `json:"data"`
 		Error string      `json:"error"`
+		Code  string      `json:"code"`
 	}
 	respObj.Data = reply
 	if err := json.Unmarshal(contents, &respObj); err != nil {
+		if res.StatusCode != http.StatusOK {
+			return &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+		}
 		return errors.New(err.Error() + ": " + string(contents))
 	}
 	if respObj.Error != "" {
-		return errors.New("remote error: " + respObj.Error)
+		return &RemoteError{Code: respObj.Code, Message: respObj.Error}
 	}
 	if reply != nil {
 		dataJSON, _ := json.Marshal(respObj.Data)
@@ -216,48 +1188,76 @@ func (c *Client) apiCall(name string, msg, reply interface{}) error {
 	return nil
 }
 
-func (c *Client) streamCall(done <-chan struct{}, path, query string) (<-chan LogRecord,
-	<-chan error) {
+// getCall makes a GET request to an API which responds
+// with raw data rather than JSON.
+//
+// On success, the caller must close the returned body.
+func (c *Client) getCall(ctx context.Context, name string, query url.Values) (io.ReadCloser,
+	error) {
+	u := c.rootURL
+	u.Path = "/api/" + name
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusOK {
+		return res.Body, nil
+	}
+	defer res.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	message := strings.TrimSpace(string(msg))
+	switch res.StatusCode {
+	case http.StatusForbidden:
+		return nil, &RemoteError{Code: CodeNotAuthenticated, Message: message}
+	case http.StatusNotFound:
+		return nil, &RemoteError{Code: CodeUnknownMedia, Message: message}
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+		return nil, &RemoteError{Message: message}
+	}
+	return nil, &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+}
+
+func (c *Client) streamCall(ctx context.Context, cancel <-chan struct{}, path,
+	query string) (<-chan LogRecord, <-chan error) {
 	resChan := make(chan LogRecord, 1)
 	errChan := make(chan error, 1)
 	go func() {
 		defer close(resChan)
 		defer close(errChan)
 
+		ctx, cancelCtx := context.WithCancel(ctx)
+		defer cancelCtx()
+		if cancel != nil {
+			go func() {
+				select {
+				case <-cancel:
+					cancelCtx()
+				case <-ctx.Done():
+				}
+			}()
+		}
+		done := ctx.Done()
+
 		u := c.websocketURL()
 		u.Path = path
 		u.RawQuery = query
 
-		conn, err := net.Dial("tcp", u.Host)
-		if err != nil {
-			errChan <- essentials.AddCtx("stream log", err)
-			return
+		cli, err := c.dialStream(ctx, u)
+		if errors.Is(err, ErrNotAuthenticated) && c.relogin(ctx) {
+			cli, err = c.dialStream(ctx, u)
 		}
-
-		// Create dummy request for the AddCookie magic.
-		req, err := http.NewRequest("GET", c.rootURL.String(), nil)
 		if err != nil {
 			errChan <- essentials.AddCtx("stream log", err)
 			return
 		}
-		for _, c := range c.c.Jar.Cookies(&c.rootURL) {
-			req.AddCookie(c)
-		}
-		req.Header.Set("Host", hostname(u.Host))
 
-		cli, _, err := websocket.NewClient(conn, u, req.Header, 100, 100)
-		if err != nil {
-			errChan <- essentials.AddCtx("stream log", err)
-			return
-		}
-
-		cleanupChan := make(chan struct{})
-		defer close(cleanupChan)
 		go func() {
-			select {
-			case <-done:
-			case <-cleanupChan:
-			}
+			<-done
 			cli.Close()
 		}()
 
@@ -283,6 +1283,51 @@ func (c *Client) streamCall(done <-chan struct{}, path, query string) (<-chan Lo
 	return resChan, errChan
 }
 
+func (c *Client) dialStream(ctx context.Context, u *url.URL) (*websocket.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create dummy request for the AddCookie magic.
+	req, err := http.NewRequest("GET", c.rootURL.String(), nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for _, c := range c.c.Jar.Cookies(&c.rootURL) {
+		req.AddCookie(c)
+	}
+	req.Header.Set("Host", hostname(u.Host))
+
+	cli, res, err := websocket.NewClient(conn, u, req.Header, 100, 100)
+	if err != nil {
+		conn.Close()
+		if remoteErr := handshakeError(res); remoteErr != nil {
+			return nil, remoteErr
+		}
+		return nil, err
+	}
+	return cli, nil
+}
+
+// handshakeError extracts an API error from the response
+// to a failed websocket handshake, if there is one.
+func handshakeError(res *http.Response) error {
+	if res == nil || res.Body == nil {
+		return nil
+	}
+	var respObj struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&respObj); err != nil || respObj.Error == "" {
+		return nil
+	}
+	return &RemoteError{Code: respObj.Code, Message: respObj.Error}
+}
+
 func (c *Client) websocketURL() *url.URL {
 	u := c.rootURL
 	if m, _ := regexp.MatchString(":[0-9]*$", u.Host); !m {
@@ -300,6 +1345,15 @@ func (c *Client) websocketURL() *url.URL {
 	return &u
 }
 
+// NewIdempotencyKey generates a random key for use with
+// methods like AddBatchKeyContext.
+func NewIdempotencyKey() string {
+	data := make([]byte, 16)
+	_, err := rand.Read(data)
+	essentials.Must(err)
+	return hex.EncodeToString(data)
+}
+
 func hostname(h string) string {
 	expr := regexp.MustCompile(":[0-9]*$")
 	return expr.ReplaceAllString(h, "")
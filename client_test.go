@@ -0,0 +1,809 @@
+package statushub_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/unixpickle/ratelimit"
+	"github.com/unixpickle/statushub"
+	"github.com/unixpickle/statushub/server"
+)
+
+const testPassword = "password"
+
+// testRetryPolicy retries quickly so that tests of
+// transient failures do not take long.
+var testRetryPolicy = statushub.RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     time.Millisecond * 5,
+}
+
+// A testServer runs a server in-process, and can inject
+// failures into the requests it handles.
+type testServer struct {
+	HTTP   *httptest.Server
+	Server *server.Server
+
+	lock     sync.Mutex
+	requests map[string]int
+	failures map[string]int
+	drops    map[string]int
+	expired  bool
+}
+
+// newTestServer starts a server and creates a client which
+// is logged in to it.
+func newTestServer(t *testing.T) (*testServer, *statushub.Client) {
+	blobs, err := server.NewBlobStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.NewServer(server.NewConfig(testPassword), blobs, "", 0)
+	s.LoginLimit = ratelimit.NewTimeSliceLimiter(time.Minute, 3)
+	ts := &testServer{
+		Server:   s,
+		requests: map[string]int{},
+		failures: map[string]int{},
+		drops:    map[string]int{},
+	}
+	ts.HTTP = httptest.NewServer(ts.handler(s.Handler()))
+	t.Cleanup(ts.HTTP.Close)
+
+	client := ts.NewClient(t)
+	if err := client.Login(testPassword); err != nil {
+		t.Fatal(err)
+	}
+	return ts, client
+}
+
+// NewClient creates a client which is not logged in.
+func (t *testServer) NewClient(tb testing.TB) *statushub.Client {
+	client, err := statushub.NewClient(t.HTTP.URL)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	client.SetRetryPolicy(testRetryPolicy)
+	return client
+}
+
+// Fail causes the next n requests to a path to fail with
+// a 503 error before they reach the server.
+func (t *testServer) Fail(path string, n int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.failures[path] = n
+}
+
+// Drop causes the next n requests to a path to be handled
+// by the server, but to fail with a 503 error as if the
+// response had been lost.
+func (t *testServer) Drop(path string, n int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.drops[path] = n
+}
+
+// Expire makes the server ignore the session cookies of
+// every request until the next login.
+func (t *testServer) Expire() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.expired = true
+}
+
+// Requests returns the number of requests to a path.
+func (t *testServer) Requests(path string) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.requests[path]
+}
+
+func (t *testServer) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.lock.Lock()
+		path := r.URL.Path
+		t.requests[path]++
+		fail := t.failures[path] > 0
+		if fail {
+			t.failures[path]--
+		}
+		drop := !fail && t.drops[path] > 0
+		if drop {
+			t.drops[path]--
+		}
+		if path == "/login" {
+			t.expired = false
+		} else if t.expired {
+			r.Header.Del("Cookie")
+		}
+		t.lock.Unlock()
+
+		if fail {
+			http.Error(w, "injected failure", http.StatusServiceUnavailable)
+		} else if drop {
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			http.Error(w, "injected failure", http.StatusServiceUnavailable)
+		} else {
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+func TestClientErrors(t *testing.T) {
+	ts, client := newTestServer(t)
+
+	checkCode := func(err error, sentinel error, code string) {
+		t.Helper()
+		if sentinel != nil && !errors.Is(err, sentinel) {
+			t.Errorf("expected %v but got %v", sentinel, err)
+		}
+		var remoteErr *statushub.RemoteError
+		if !errors.As(err, &remoteErr) {
+			t.Errorf("expected a RemoteError but got %v", err)
+		} else if remoteErr.Code != code {
+			t.Errorf("expected code %q but got %q", code, remoteErr.Code)
+		}
+	}
+
+	unauthenticated := ts.NewClient(t)
+	_, err := unauthenticated.Overview()
+	checkCode(err, statushub.ErrNotAuthenticated, statushub.CodeNotAuthenticated)
+	err = unauthenticated.MediaView(1, &bytes.Buffer{})
+	checkCode(err, statushub.ErrNotAuthenticated, statushub.CodeNotAuthenticated)
+
+	_, err = client.ServiceLog("missing")
+	checkCode(err, statushub.ErrUnknownService, statushub.CodeUnknownService)
+	err = client.Delete("missing")
+	checkCode(err, statushub.ErrUnknownService, statushub.CodeUnknownService)
+	if errors.Is(err, statushub.ErrUnknownMedia) {
+		t.Error("unknown service error should not match ErrUnknownMedia")
+	}
+
+	_, err = client.MediaLog("missing")
+	checkCode(err, statushub.ErrUnknownMedia, statushub.CodeUnknownMedia)
+	err = client.MediaView(1337, &bytes.Buffer{})
+	checkCode(err, statushub.ErrUnknownMedia, statushub.CodeUnknownMedia)
+
+	// Errors without a code are still RemoteErrors.
+	_, err = client.Compare(nil, nil)
+	checkCode(err, nil, "")
+	if statushub.IsTransient(err) {
+		t.Error("uncategorized remote error should not be transient")
+	}
+
+	// Unexpected statuses are reported as StatusErrors.
+	ts.Fail("/api/overview", testRetryPolicy.MaxAttempts)
+	_, err = client.Overview()
+	var statusErr *statushub.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected StatusError but got %v", err)
+	}
+
+	// Each failed login uses up one attempt of the rate
+	// limit, which allows three attempts.
+	for i := 0; i < 4; i++ {
+		err = unauthenticated.Login("wrong")
+		if err == nil {
+			t.Fatal("login should fail")
+		} else if errors.Is(err, statushub.ErrRateLimited) {
+			t.Fatalf("attempt %d should not be rate limited", i)
+		}
+	}
+	err = unauthenticated.Login(testPassword)
+	checkCode(err, statushub.ErrRateLimited, statushub.CodeRateLimited)
+	if !statushub.IsTransient(err) {
+		t.Error("rate limit error should be transient")
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	transient := &statushub.StatusError{StatusCode: 503, Status: "503 Service Unavailable"}
+	policy := statushub.RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Millisecond * 10,
+		MaxBackoff:     time.Millisecond * 30,
+	}
+
+	var times []time.Time
+	err := policy.Retry(context.Background(), func() error {
+		times = append(times, time.Now())
+		return transient
+	})
+	if err != transient {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(times) != policy.MaxAttempts {
+		t.Fatalf("expected %d attempts but got %d", policy.MaxAttempts, len(times))
+	}
+	// The backoff doubles until it reaches MaxBackoff.
+	expected := []time.Duration{10, 20, 30, 30}
+	for i, backoff := range expected {
+		backoff *= time.Millisecond
+		if actual := times[i+1].Sub(times[i]); actual < backoff {
+			t.Errorf("attempt %d: expected backoff of at least %v but got %v", i+2, backoff,
+				actual)
+		}
+	}
+
+	attempts := 0
+	err = policy.Retry(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return transient
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("expected success after 3 attempts but got %v after %d", err, attempts)
+	}
+
+	attempts = 0
+	permanent := &statushub.RemoteError{Code: statushub.CodeUnknownService}
+	err = policy.Retry(context.Background(), func() error {
+		attempts++
+		return permanent
+	})
+	if err != permanent || attempts != 1 {
+		t.Errorf("permanent error was retried: %d attempts", attempts)
+	}
+
+	attempts = 0
+	err = statushub.RetryPolicy{}.Retry(context.Background(), func() error {
+		attempts++
+		return transient
+	})
+	if err != transient || attempts != 1 {
+		t.Errorf("zero policy should not retry: %d attempts", attempts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	slowPolicy := statushub.RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour}
+	err = slowPolicy.Retry(ctx, func() error {
+		attempts++
+		time.AfterFunc(time.Millisecond*10, cancel)
+		return transient
+	})
+	if err != transient || attempts != 1 {
+		t.Errorf("expected cancellation after 1 attempt but got %v after %d", err, attempts)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	ts, client := newTestServer(t)
+	if _, err := client.Add("svc", "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	ts.Fail("/api/serviceLog", testRetryPolicy.MaxAttempts-1)
+	log, err := client.ServiceLog("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 || log[0].Message != "hello" {
+		t.Errorf("unexpected log: %v", log)
+	}
+	if n := ts.Requests("/api/serviceLog"); n != testRetryPolicy.MaxAttempts {
+		t.Errorf("expected %d requests but got %d", testRetryPolicy.MaxAttempts, n)
+	}
+
+	ts.Fail("/api/serviceLog", testRetryPolicy.MaxAttempts)
+	if _, err := client.ServiceLog("svc"); err == nil {
+		t.Error("call should fail after running out of attempts")
+	}
+
+	// Calls which are not idempotent are not retried.
+	ts.Fail("/api/delete", 1)
+	if err := client.Delete("svc"); err == nil {
+		t.Error("delete should not be retried")
+	}
+	if n := ts.Requests("/api/delete"); n != 1 {
+		t.Errorf("expected 1 delete request but got %d", n)
+	}
+
+	ts.Fail("/api/mediaView", 1)
+	id, err := client.AddMedia("folder", "a.txt", "text/plain", []byte("hi"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := client.MediaView(id, &buf); err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "hi" {
+		t.Errorf("unexpected media: %q", buf.String())
+	}
+	if n := ts.Requests("/api/mediaView"); n != 2 {
+		t.Errorf("expected 2 media requests but got %d", n)
+	}
+
+	ts.Fail("/api/export", 1)
+	if err := client.Export(&bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := ts.Requests("/api/export"); n != 2 {
+		t.Errorf("expected 2 export requests but got %d", n)
+	}
+}
+
+func TestClientRelogin(t *testing.T) {
+	ts, client := newTestServer(t)
+	if _, err := client.Add("svc", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := client.AddMedia("folder", "a.txt", "text/plain", []byte("hi"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logins := ts.Requests("/login")
+
+	ts.Expire()
+	if _, err := client.ServiceLog("svc"); err != nil {
+		t.Fatal(err)
+	}
+	ts.Expire()
+	if err := client.Delete("svc"); err != nil {
+		t.Fatal(err)
+	}
+	ts.Expire()
+	if err := client.MediaView(id, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	ts.Expire()
+	if err := client.Export(&bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := ts.Requests("/login") - logins; n != 4 {
+		t.Errorf("expected 4 logins but got %d", n)
+	}
+
+	// The new password is used after a password change.
+	if err := client.ChangePassword(testPassword, "new password"); err != nil {
+		t.Fatal(err)
+	}
+	ts.Expire()
+	if _, err := client.Overview(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Clients which never logged in do not try to.
+	logins = ts.Requests("/login")
+	_, err = ts.NewClient(t).Overview()
+	if !errors.Is(err, statushub.ErrNotAuthenticated) {
+		t.Errorf("expected ErrNotAuthenticated but got %v", err)
+	}
+	if n := ts.Requests("/login"); n != logins {
+		t.Error("client without a password tried to log in")
+	}
+}
+
+func TestClientIdempotency(t *testing.T) {
+	ts, client := newTestServer(t)
+
+	ts.Drop("/api/add", 1)
+	id, err := client.Add("svc", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Drop("/api/addBatch", 2)
+	ids, err := client.AddBatch("svc", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.Requests("/api/add") != 2 || ts.Requests("/api/addBatch") != 3 {
+		t.Error("dropped requests were not retried")
+	}
+
+	log, err := client.ServiceLog("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	var logIDs []int
+	for _, record := range log {
+		messages = append(messages, record.Message)
+		logIDs = append(logIDs, record.ID)
+	}
+	if !reflect.DeepEqual(messages, []string{"b", "a", "hello"}) {
+		t.Errorf("unexpected messages: %v", messages)
+	}
+	if !reflect.DeepEqual(logIDs, []int{ids[1], ids[0], id}) {
+		t.Errorf("IDs %v do not match returned IDs %d and %v", logIDs, id, ids)
+	}
+
+	ctx := context.Background()
+	key := statushub.NewIdempotencyKey()
+	id1, err := client.AddKeyContext(ctx, "svc", key, "keyed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := client.AddKeyContext(ctx, "svc", key, "keyed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id1 != id2 {
+		t.Errorf("same key gave different IDs: %d and %d", id1, id2)
+	}
+	id3, err := client.AddKeyContext(ctx, "other", key, "keyed")
+	if err != nil {
+		t.Fatal(err)
+	} else if id3 == id1 {
+		t.Error("keys should be scoped to a service")
+	}
+	if log, err := client.ServiceLog("svc"); err != nil {
+		t.Fatal(err)
+	} else if len(log) != 4 {
+		t.Errorf("expected 4 records but got %d", len(log))
+	}
+}
+
+func TestClientLogAPI(t *testing.T) {
+	_, client := newTestServer(t)
+
+	if _, err := client.AddBatch("mnist/run1", []string{"step=1 loss=3", "step=2 loss=2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.AddBatch("mnist/run2", []string{"step=1 loss=4", "step=2 loss=1"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.AddEntries("other", []statushub.Entry{
+		{Message: "warning", Level: statushub.LevelWarn, Labels: statushub.Labels{"a": "b"}},
+		{Message: "info", Level: statushub.LevelInfo},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overview, err := client.Overview()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overview) != 3 {
+		t.Fatalf("expected 3 services but got %d", len(overview))
+	}
+	for _, record := range overview {
+		if record.Service == "other" && record.MaxLevel != statushub.LevelWarn {
+			t.Errorf("expected max level warn but got %v", record.MaxLevel)
+		}
+	}
+	groups, err := client.GroupOverview("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	numServices := map[string]int{}
+	for _, group := range groups {
+		numServices[group.Namespace] = group.NumServices
+	}
+	if !reflect.DeepEqual(numServices, map[string]int{"mnist": 2, "other": 1}) {
+		t.Errorf("unexpected groups: %v", groups)
+	}
+
+	fullLog, err := client.FullLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fullLog) != 6 || fullLog[0].Message != "info" {
+		t.Errorf("unexpected full log: %v", fullLog)
+	}
+	filtered, err := client.FullLogFilterContext(context.Background(),
+		&statushub.LogFilter{MinLevel: statushub.LevelWarn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) != 1 || filtered[0].Message != "warning" {
+		t.Errorf("unexpected filtered log: %v", filtered)
+	}
+
+	comparison, err := client.Compare([]string{"mnist/run1", "mnist/run2"},
+		&statushub.CompareOptions{StepField: "step"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comparison.Fields) != 1 || comparison.Fields[0].Field != "loss" {
+		t.Fatalf("unexpected comparison: %v", comparison)
+	}
+	runs := comparison.Fields[0].Runs
+	if runs[0].Final.Value != 2 || runs[1].Final.Value != 1 || runs[1].Delta != -1 {
+		t.Errorf("unexpected runs: %v", runs)
+	}
+
+	labels := statushub.Labels{"model": "cnn"}
+	if err := client.SetServiceLabels("mnist/run1", labels); err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := client.ServiceLabels("mnist/run1"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(actual, labels) {
+		t.Errorf("expected labels %v but got %v", labels, actual)
+	}
+
+	if info, err := client.ServiceInfo("mnist/run1"); err != nil || info != nil {
+		t.Errorf("expected no info but got %s (%v)", info, err)
+	}
+	if err := client.SetServiceInfo("mnist/run1", map[string]int{"lr": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := client.ServiceInfo("mnist/run1"); err != nil {
+		t.Fatal(err)
+	} else {
+		var obj map[string]int
+		if err := json.Unmarshal(info, &obj); err != nil || obj["lr"] != 3 {
+			t.Errorf("unexpected info: %s", info)
+		}
+	}
+
+	if err := client.SetProgress("mnist/run1", 5, 10); err != nil {
+		t.Fatal(err)
+	}
+	overview, err = client.Overview()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range overview {
+		if record.Service != "mnist/run1" {
+			continue
+		}
+		if record.Progress == nil || record.Progress.Done != 5 || record.Progress.Total != 10 {
+			t.Errorf("unexpected progress: %v", record.Progress)
+		}
+	}
+
+	if names, err := client.DeleteNamespace("mnist", false); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(names, []string{"mnist/run1", "mnist/run2"}) {
+		t.Errorf("unexpected services to delete: %v", names)
+	}
+	if _, err := client.ServiceLog("mnist/run1"); err != nil {
+		t.Error("dry run deleted services")
+	}
+	if _, err := client.DeleteNamespace("mnist", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Delete("other"); err != nil {
+		t.Fatal(err)
+	}
+	if overview, err := client.Overview(); err != nil {
+		t.Fatal(err)
+	} else if len(overview) != 0 {
+		t.Errorf("expected no services but got %v", overview)
+	}
+}
+
+func TestClientMediaAPI(t *testing.T) {
+	_, client := newTestServer(t)
+
+	img1 := testPNG(t, color.Black)
+	img2 := testPNG(t, color.White)
+	id1, err := client.AddLinkedMedia("svc", "folder", "img.png", "image/png", img1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := client.AddMediaReader("folder", "img.png", "image/png", bytes.NewReader(img2),
+		-1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.AddMedia("folder", "a.txt", "text/plain", []byte("hi"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := client.ServiceLog("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 1 || log[0].Message != statushub.MediaMessage("folder", "img.png") ||
+		!reflect.DeepEqual(log[0].MediaIDs, []int{id1}) {
+		t.Errorf("unexpected linked record: %v", log)
+	}
+
+	mediaLog, err := client.MediaLog("folder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mediaLog) != 2 || mediaLog[1].ID != id2 || mediaLog[1].Width != 4 {
+		t.Errorf("unexpected media log: %v", mediaLog)
+	}
+	versions, err := client.MediaVersions("folder", "img.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].ID != id2 || !versions[1].Replaced {
+		t.Errorf("unexpected versions: %v", versions)
+	}
+	if record, err := client.MediaVersion("folder", "img.png", 1); err != nil {
+		t.Fatal(err)
+	} else if record.ID != id1 {
+		t.Errorf("expected version 1 to have ID %d but got %d", id1, record.ID)
+	}
+	if overview, err := client.MediaOverview(); err != nil {
+		t.Fatal(err)
+	} else if len(overview) != 1 || overview[0].Folder != "folder" {
+		t.Errorf("unexpected media overview: %v", overview)
+	}
+
+	var buf bytes.Buffer
+	if err := client.MediaView(id1, &buf); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), img1) {
+		t.Error("media contents do not match")
+	}
+	for _, download := range []func(*bytes.Buffer) error{
+		func(buf *bytes.Buffer) error { return client.MediaThumb(id1, 2, buf) },
+		func(buf *bytes.Buffer) error { return client.MediaDiff(id1, id2, "", buf) },
+		func(buf *bytes.Buffer) error { return client.MediaDiff(id1, id2, "side", buf) },
+	} {
+		var buf bytes.Buffer
+		if err := download(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := image.Decode(&buf); err != nil {
+			t.Errorf("bad image: %v", err)
+		}
+	}
+	err = client.MediaDiff(id1, id2, "bad mode", &bytes.Buffer{})
+	var remoteErr *statushub.RemoteError
+	if !errors.As(err, &remoteErr) {
+		t.Errorf("expected RemoteError but got %v", err)
+	}
+
+	if err := client.DeleteMedia("folder"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.MediaLog("folder"); !errors.Is(err, statushub.ErrUnknownMedia) {
+		t.Errorf("expected ErrUnknownMedia but got %v", err)
+	}
+}
+
+func TestClientAdminAPI(t *testing.T) {
+	ts, client := newTestServer(t)
+
+	prefs, err := client.GetPrefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefs.LogSize = 2
+	if err := client.SetPrefs(prefs); err != nil {
+		t.Fatal(err)
+	}
+	if actual, err := client.GetPrefs(); err != nil {
+		t.Fatal(err)
+	} else if *actual != *prefs {
+		t.Errorf("expected prefs %v but got %v", prefs, actual)
+	}
+	if _, err := client.AddBatch("svc", []string{"a", "b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if log, err := client.ServiceLog("svc"); err != nil {
+		t.Fatal(err)
+	} else if len(log) != 2 {
+		t.Errorf("expected log size 2 but got %d", len(log))
+	}
+
+	if err := client.ChangePassword("wrong", "new"); err == nil {
+		t.Error("change with wrong password should fail")
+	}
+	if err := client.ChangePassword(testPassword, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.NewClient(t).Login("new"); err != nil {
+		t.Errorf("login with new password failed: %v", err)
+	}
+
+	if _, err := client.AddMedia("folder", "a.txt", "text/plain", []byte("hi"), false); err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	if err := client.Export(&archive); err != nil {
+		t.Fatal(err)
+	}
+	_, otherClient := newTestServer(t)
+	stats, err := otherClient.Import(&archive, statushub.ImportOptions{Replace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := statushub.ImportStats{Services: 1, Records: 2, Media: 1}
+	if *stats != expected {
+		t.Errorf("expected stats %v but got %v", expected, *stats)
+	}
+	mediaLog, err := otherClient.MediaLog("folder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := otherClient.MediaView(mediaLog[0].ID, &buf); err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "hi" {
+		t.Errorf("unexpected imported media: %q", buf.String())
+	}
+	if _, err := otherClient.Import(bytes.NewReader([]byte("junk")),
+		statushub.ImportOptions{}); err == nil {
+		t.Error("import of junk should fail")
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	_, client := newTestServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	serviceStream, serviceErrs := client.ServiceStreamContext(ctx, "svc")
+	fullStream, fullErrs := client.FullStreamContext(ctx)
+
+	// Streams only include records added after they
+	// connect, so log until both streams are connected.
+	for _, stream := range []<-chan statushub.LogRecord{serviceStream, fullStream} {
+		for connected := false; !connected; {
+			if _, err := client.Add("svc", "ping"); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case _, connected = <-stream:
+				if !connected {
+					t.Fatal("stream closed")
+				}
+			case <-time.After(time.Millisecond * 10):
+			}
+		}
+	}
+	if _, err := client.Add("svc", "ready"); err != nil {
+		t.Fatal(err)
+	}
+	for _, stream := range []<-chan statushub.LogRecord{serviceStream, fullStream} {
+		for record := range stream {
+			if record.Message == "ready" {
+				break
+			}
+		}
+	}
+
+	if _, err := client.Add("other", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Add("svc", "after"); err != nil {
+		t.Fatal(err)
+	}
+	if record := <-serviceStream; record.Message != "after" {
+		t.Errorf("unexpected service record: %v", record)
+	}
+	for _, expected := range []string{"other", "after"} {
+		if record := <-fullStream; record.Message != expected {
+			t.Errorf("expected %q but got %v", expected, record)
+		}
+	}
+
+	cancel()
+	for range serviceStream {
+	}
+	for range fullStream {
+	}
+	for _, errs := range []<-chan error{serviceErrs, fullErrs} {
+		if err := <-errs; err != nil && !errors.Is(err, context.Canceled) {
+			t.Errorf("unexpected stream error: %v", err)
+		}
+	}
+}
+
+func testPNG(t *testing.T, c color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,228 @@
+package statushub
+
+import (
+	"sort"
+
+	"github.com/unixpickle/essentials"
+)
+
+// Alignment modes for CompareOptions.AlignBy.
+const (
+	AlignStep = "step"
+	AlignTime = "time"
+)
+
+// CompareOptions configures a comparison between runs.
+type CompareOptions struct {
+	// AlignBy is AlignStep or AlignTime.
+	// The empty string is equivalent to AlignStep.
+	//
+	// When aligning by time, each run's time is measured
+	// in seconds from the run's first record, and the
+	// times of the resulting FieldPoints are relative.
+	AlignBy string `json:"alignBy,omitempty"`
+
+	// StepField optionally names a field (e.g. "step")
+	// which holds the step of every record.
+	// See ExtractSeries.
+	StepField string `json:"stepField,omitempty"`
+
+	// Fields optionally limits the comparison to certain
+	// fields.
+	Fields []string `json:"fields,omitempty"`
+
+	// Maximize lists the fields for which higher values are
+	// better.
+	// For all other fields, lower values are better.
+	Maximize []string `json:"maximize,omitempty"`
+
+	// AvgSizes are the moving average window sizes.
+	// If it is empty, DefaultAvgSizes is used.
+	AvgSizes []int `json:"avgSizes,omitempty"`
+}
+
+// A RunComparison compares numeric fields across runs.
+type RunComparison struct {
+	Services []string          `json:"services"`
+	Fields   []FieldComparison `json:"fields"`
+}
+
+// A FieldComparison compares one field across runs.
+type FieldComparison struct {
+	Field string `json:"field"`
+
+	// Aligned is the last step (or elapsed time, in
+	// seconds) which every run with the field has reached.
+	// Aligned values are compared at this point.
+	Aligned int64 `json:"aligned"`
+
+	// Runs contains one summary per service, in the same
+	// order as RunComparison.Services.
+	Runs []FieldSummary `json:"runs"`
+}
+
+// A FieldSummary summarizes one field of one run.
+type FieldSummary struct {
+	Service string `json:"service"`
+
+	// Count is the number of values.
+	// If it is 0, the run does not have the field and the
+	// other values are meaningless.
+	Count int `json:"count"`
+
+	Final FieldPoint `json:"final"`
+	Best  FieldPoint `json:"best"`
+
+	// AlignedValue is the latest value at or before the
+	// aligned point.
+	AlignedValue float64 `json:"alignedValue"`
+
+	// MovingAvg maps window sizes to the mean of the last
+	// values at or before the aligned point.
+	MovingAvg map[int]float64 `json:"movingAvg"`
+
+	// Delta is AlignedValue minus the AlignedValue of the
+	// first run with the field.
+	Delta float64 `json:"delta"`
+
+	// AvgDelta is like Delta, but for every moving average.
+	AvgDelta map[int]float64 `json:"avgDelta"`
+}
+
+// CompareRuns compares the numeric fields in the logs of
+// multiple services.
+//
+// Each log may be in any order, as with ExtractSeries.
+func CompareRuns(services []string, logs [][]LogRecord, opts *CompareOptions) *RunComparison {
+	if opts == nil {
+		opts = &CompareOptions{}
+	}
+	avgSizes := opts.AvgSizes
+	if len(avgSizes) == 0 {
+		avgSizes = DefaultAvgSizes
+	}
+
+	series := make([]map[string][]FieldPoint, len(logs))
+	fieldSet := map[string]bool{}
+	for i, log := range logs {
+		series[i] = ExtractSeries(log, opts.StepField)
+		for name := range series[i] {
+			if len(opts.Fields) == 0 || essentials.Contains(opts.Fields, name) {
+				fieldSet[name] = true
+			}
+		}
+	}
+	fields := make([]string, 0, len(fieldSet))
+	for name := range fieldSet {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+
+	res := &RunComparison{Services: services, Fields: []FieldComparison{}}
+	for _, field := range fields {
+		runSeries := make([][]FieldPoint, len(logs))
+		for i, log := range logs {
+			runSeries[i] = series[i][field]
+			if opts.AlignBy == AlignTime && len(log) > 0 {
+				runSeries[i] = elapsedTimes(runSeries[i], startTime(log))
+			}
+		}
+		res.Fields = append(res.Fields, compareField(services, field, runSeries, opts,
+			avgSizes))
+	}
+	return res
+}
+
+func compareField(services []string, field string, runSeries [][]FieldPoint,
+	opts *CompareOptions, avgSizes []int) FieldComparison {
+	maximize := essentials.Contains(opts.Maximize, field)
+	alignKey := func(p FieldPoint) int64 {
+		if opts.AlignBy == AlignTime {
+			return p.Time
+		}
+		return int64(p.Step)
+	}
+
+	res := FieldComparison{Field: field, Aligned: -1}
+	for _, points := range runSeries {
+		if len(points) == 0 {
+			continue
+		}
+		last := alignKey(points[len(points)-1])
+		if res.Aligned == -1 || last < res.Aligned {
+			res.Aligned = last
+		}
+	}
+
+	var baseline *FieldSummary
+	for i, points := range runSeries {
+		summary := FieldSummary{
+			Service:   services[i],
+			Count:     len(points),
+			MovingAvg: map[int]float64{},
+			AvgDelta:  map[int]float64{},
+		}
+		if len(points) > 0 {
+			summary.Final = points[len(points)-1]
+			summary.Best = points[0]
+			for _, p := range points[1:] {
+				if (maximize && p.Value > summary.Best.Value) ||
+					(!maximize && p.Value < summary.Best.Value) {
+					summary.Best = p
+				}
+			}
+			numAligned := sort.Search(len(points), func(j int) bool {
+				return alignKey(points[j]) > res.Aligned
+			})
+			if numAligned == 0 {
+				numAligned = 1
+			}
+			aligned := points[:numAligned]
+			summary.AlignedValue = aligned[len(aligned)-1].Value
+			for _, size := range avgSizes {
+				summary.MovingAvg[size] = trailingMean(aligned, size)
+			}
+			if baseline == nil {
+				baseline = &summary
+			}
+			summary.Delta = summary.AlignedValue - baseline.AlignedValue
+			for _, size := range avgSizes {
+				summary.AvgDelta[size] = summary.MovingAvg[size] - baseline.MovingAvg[size]
+			}
+		}
+		res.Runs = append(res.Runs, summary)
+	}
+	return res
+}
+
+// startTime finds the time of the earliest record in a
+// log, which may be in any order.
+func startTime(log []LogRecord) int64 {
+	start := log[0].Time
+	for _, record := range log[1:] {
+		if record.Time < start {
+			start = record.Time
+		}
+	}
+	return start
+}
+
+func elapsedTimes(points []FieldPoint, start int64) []FieldPoint {
+	res := make([]FieldPoint, len(points))
+	for i, p := range points {
+		p.Time -= start
+		res[i] = p
+	}
+	return res
+}
+
+func trailingMean(points []FieldPoint, size int) float64 {
+	if len(points) > size {
+		points = points[len(points)-size:]
+	}
+	var sum float64
+	for _, p := range points {
+		sum += p.Value
+	}
+	return sum / float64(len(points))
+}
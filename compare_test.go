@@ -0,0 +1,44 @@
+package statushub_test
+
+import (
+	"testing"
+
+	"github.com/unixpickle/statushub"
+)
+
+func TestCompareRunsAlignTime(t *testing.T) {
+	// Logs are newest first, as returned by ServiceLog.
+	logs := [][]statushub.LogRecord{
+		{
+			{ID: 4, Time: 130, Message: "loss=2"},
+			{ID: 3, Time: 120, Message: "loss=3"},
+			{ID: 2, Time: 110, Message: "loss=4"},
+			{ID: 1, Time: 100, Message: "loss=5"},
+		},
+		{
+			{ID: 7, Time: 1010, Message: "loss=1"},
+			{ID: 6, Time: 1005, Message: "loss=5"},
+			{ID: 5, Time: 1000, Message: "loss=6"},
+		},
+	}
+	comparison := statushub.CompareRuns([]string{"a", "b"}, logs,
+		&statushub.CompareOptions{AlignBy: statushub.AlignTime})
+	if len(comparison.Fields) != 1 {
+		t.Fatalf("expected 1 field but got %d", len(comparison.Fields))
+	}
+	field := comparison.Fields[0]
+	if field.Aligned != 10 {
+		t.Errorf("expected alignment at 10 seconds but got %d", field.Aligned)
+	}
+	runs := field.Runs
+	if runs[0].AlignedValue != 4 || runs[1].AlignedValue != 1 {
+		t.Errorf("unexpected aligned values: %v and %v", runs[0].AlignedValue,
+			runs[1].AlignedValue)
+	}
+	if runs[0].Final.Time != 30 || runs[0].Final.Value != 2 {
+		t.Errorf("unexpected final point: %v", runs[0].Final)
+	}
+	if runs[1].Delta != -3 {
+		t.Errorf("expected delta -3 but got %v", runs[1].Delta)
+	}
+}
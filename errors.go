@@ -0,0 +1,66 @@
+package statushub
+
+import "errors"
+
+// Error codes which the server attaches to API errors.
+const (
+	CodeNotAuthenticated = "not_authenticated"
+	CodeUnknownService   = "unknown_service"
+	CodeRateLimited      = "rate_limited"
+	CodeUnknownMedia     = "unknown_media"
+)
+
+// Sentinel errors corresponding to server error codes.
+//
+// Errors returned by a Client can be compared against
+// these using errors.Is().
+var (
+	ErrNotAuthenticated = errors.New("not authenticated")
+	ErrUnknownService   = errors.New("unknown service")
+	ErrRateLimited      = errors.New("rate limited")
+	ErrUnknownMedia     = errors.New("unknown media")
+)
+
+// A RemoteError is an error reported by the server.
+type RemoteError struct {
+	// Code is a machine-readable error code, such as
+	// CodeUnknownService.
+	// It may be empty for uncategorized errors.
+	Code string
+
+	// Message is the human-readable error message.
+	Message string
+}
+
+// Error returns the error message.
+func (r *RemoteError) Error() string {
+	return "remote error: " + r.Message
+}
+
+// Is checks if the error code corresponds to one of the
+// sentinel errors, such as ErrUnknownService.
+func (r *RemoteError) Is(target error) bool {
+	switch target {
+	case ErrNotAuthenticated:
+		return r.Code == CodeNotAuthenticated
+	case ErrUnknownService:
+		return r.Code == CodeUnknownService
+	case ErrRateLimited:
+		return r.Code == CodeRateLimited
+	case ErrUnknownMedia:
+		return r.Code == CodeUnknownMedia
+	}
+	return false
+}
+
+// A StatusError is returned when the server responds
+// with an unexpected HTTP status and no API error.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+// Error returns the error message.
+func (s *StatusError) Error() string {
+	return "unexpected status: " + s.Status
+}
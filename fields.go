@@ -0,0 +1,101 @@
+package statushub
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultAvgSizes are the moving average window sizes
+// used when summarizing numeric fields.
+var DefaultAvgSizes = []int{10, 20, 50}
+
+var fieldExp = regexp.MustCompile(`^([a-zA-Z_0-9\-]*)=([0-9\.\-e]*)$`)
+
+// A Field is one "key=value" field in a log message.
+type Field struct {
+	Name  string
+	Value float64
+}
+
+// ParseFields finds numeric fields of the form
+// "key=value" in a log message.
+//
+// Fields are returned in the order they appear, including
+// repeated fields.
+func ParseFields(message string) []Field {
+	var res []Field
+	for _, field := range strings.Fields(message) {
+		m := fieldExp.FindStringSubmatch(field)
+		if m == nil {
+			continue
+		}
+		if val, err := strconv.ParseFloat(m[2], 64); err == nil {
+			res = append(res, Field{Name: m[1], Value: val})
+		}
+	}
+	return res
+}
+
+// ExtractFields is like ParseFields, but returns a map
+// from field names to values.
+// If a field appears more than once, the last value wins.
+func ExtractFields(message string) map[string]float64 {
+	res := map[string]float64{}
+	for _, field := range ParseFields(message) {
+		res[field.Name] = field.Value
+	}
+	return res
+}
+
+// A FieldPoint is one value of a numeric field.
+type FieldPoint struct {
+	// Step is the step at which the value was logged.
+	// See ExtractSeries for how steps are determined.
+	Step int `json:"step"`
+
+	// Time is the time of the record containing the value.
+	Time int64 `json:"time"`
+
+	Value float64 `json:"value"`
+}
+
+// ExtractSeries finds the history of every numeric field
+// in a list of log records, ordered from oldest to newest.
+//
+// The records may be in any order, such as the newest
+// first order returned by Client.ServiceLog; they are
+// ordered by ID before the fields are extracted.
+//
+// If stepField is non-empty, a point's step is the value
+// of that field in the same record, and records without
+// the step field are ignored.
+// Otherwise, a point's step is its index in the series.
+func ExtractSeries(records []LogRecord, stepField string) map[string][]FieldPoint {
+	sorted := append([]LogRecord{}, records...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+	res := map[string][]FieldPoint{}
+	for _, record := range sorted {
+		fields := ExtractFields(record.Message)
+		step := -1
+		if stepField != "" {
+			stepVal, ok := fields[stepField]
+			if !ok {
+				continue
+			}
+			step = int(stepVal)
+			delete(fields, stepField)
+		}
+		for name, val := range fields {
+			point := FieldPoint{Step: step, Time: record.Time, Value: val}
+			if stepField == "" {
+				point.Step = len(res[name])
+			}
+			res[name] = append(res[name], point)
+		}
+	}
+	return res
+}
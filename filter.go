@@ -0,0 +1,86 @@
+package statushub
+
+import "net/url"
+
+// A LogFilter restricts the records returned by a query or
+// a stream.
+//
+// The zero value matches every record.
+type LogFilter struct {
+	// MinLevel is the minimum level of matching records.
+	MinLevel Level `json:"minLevel,omitempty"`
+
+	// Labels must all be present in a matching record's
+	// labels, which include the labels of its service.
+	Labels Labels `json:"labels,omitempty"`
+
+	// Namespace, if set, restricts records to services in
+	// a namespace, as in InNamespace.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Match checks if a record passes the filter.
+func (l *LogFilter) Match(r *LogRecord) bool {
+	if l == nil {
+		return true
+	}
+	if l.MinLevel != LevelUnset && r.Level.Effective() < l.MinLevel.Effective() {
+		return false
+	}
+	if !InNamespace(r.Service, l.Namespace) {
+		return false
+	}
+	return r.Labels.Contains(l.Labels)
+}
+
+// Filter returns the records which match the filter.
+func (l *LogFilter) Filter(records []LogRecord) []LogRecord {
+	var res []LogRecord
+	for _, r := range records {
+		if l.Match(&r) {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// Query encodes the filter as URL query parameters, as
+// used by streaming APIs.
+func (l *LogFilter) Query() url.Values {
+	res := url.Values{}
+	if l == nil {
+		return res
+	}
+	if l.MinLevel != LevelUnset {
+		res.Set("minLevel", l.MinLevel.String())
+	}
+	for _, label := range l.Labels.Strings() {
+		res.Add("label", label)
+	}
+	if l.Namespace != "" {
+		res.Set("namespace", l.Namespace)
+	}
+	return res
+}
+
+// ParseLogFilterQuery decodes a filter encoded with
+// LogFilter.Query.
+func ParseLogFilterQuery(query url.Values) (*LogFilter, error) {
+	res := &LogFilter{Namespace: query.Get("namespace")}
+	var err error
+	res.MinLevel, err = ParseLevel(query.Get("minLevel"))
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range query["label"] {
+		key, value, err := ParseLabel(label)
+		if err != nil {
+			return nil, err
+		}
+		if res.Labels == nil {
+			res.Labels = Labels{}
+		}
+		res.Labels[key] = value
+	}
+	return res, nil
+}
@@ -1,6 +1,6 @@
 module github.com/unixpickle/statushub
 
-go 1.18
+go 1.21
 
 require (
 	github.com/creack/pty v1.1.24
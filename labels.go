@@ -0,0 +1,86 @@
+package statushub
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Labels are key/value pairs attached to services and log
+// records, such as "host=box3".
+type Labels map[string]string
+
+// ParseLabel parses a label of the form "key=value".
+func ParseLabel(label string) (key, value string, err error) {
+	parts := strings.SplitN(label, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", errors.New("invalid label (expected key=value): " + label)
+	}
+	return parts[0], parts[1], nil
+}
+
+// Merge creates a new set of labels containing l and
+// other, where other takes precedence.
+//
+// If other is empty, l itself is returned.
+func (l Labels) Merge(other Labels) Labels {
+	if len(other) == 0 {
+		return l
+	} else if len(l) == 0 {
+		return other
+	}
+	res := make(Labels, len(l)+len(other))
+	for k, v := range l {
+		res[k] = v
+	}
+	for k, v := range other {
+		res[k] = v
+	}
+	return res
+}
+
+// Contains checks if every label in subset is also in l.
+func (l Labels) Contains(subset Labels) bool {
+	for k, v := range subset {
+		if actual, ok := l[k]; !ok || actual != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Strings returns the labels as sorted "key=value"
+// strings.
+func (l Labels) Strings() []string {
+	res := make([]string, 0, len(l))
+	for k, v := range l {
+		res = append(res, k+"="+v)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// String returns the labels as a comma-separated list of
+// "key=value" strings.
+//
+// Together with Set, this lets *Labels be used as a
+// repeatable flag.Value.
+func (l *Labels) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(l.Strings(), ",")
+}
+
+// Set parses a "key=value" label and adds it to l.
+func (l *Labels) Set(label string) error {
+	key, value, err := ParseLabel(label)
+	if err != nil {
+		return err
+	}
+	if *l == nil {
+		*l = Labels{}
+	}
+	(*l)[key] = value
+	return nil
+}
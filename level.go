@@ -0,0 +1,78 @@
+package statushub
+
+import (
+	"errors"
+	"strings"
+)
+
+// A Level is the severity of a log record.
+//
+// Records without a level have LevelUnset, which is
+// treated like LevelInfo when filtering.
+type Level int
+
+const (
+	LevelUnset Level = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+// ParseLevel parses a level name, such as "warn".
+//
+// The empty string is parsed as LevelUnset.
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(name)
+	if name == "" {
+		return LevelUnset, nil
+	} else if name == "warning" {
+		return LevelWarn, nil
+	}
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return LevelUnset, errors.New("unknown log level: " + name)
+}
+
+// String returns the name of the level, or the empty
+// string for LevelUnset.
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// Effective returns the level to use for comparisons,
+// treating LevelUnset as LevelInfo.
+func (l Level) Effective() Level {
+	if l == LevelUnset {
+		return LevelInfo
+	}
+	return l
+}
+
+// MarshalText encodes the level as its name.
+func (l Level) MarshalText() ([]byte, error) {
+	if _, ok := levelNames[l]; !ok && l != LevelUnset {
+		return nil, errors.New("invalid log level")
+	}
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText decodes a level name.
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
@@ -0,0 +1,14 @@
+package statushub
+
+// MediaMessagePrefix starts the message of a log record
+// which was added to link to a media record.
+//
+// The sh-log command also treats lines with this prefix
+// as requests to upload the named file.
+const MediaMessagePrefix = "@media "
+
+// MediaMessage creates the message for a log record which
+// links to a media record, such as "@media samples/x.png".
+func MediaMessage(folder, filename string) string {
+	return MediaMessagePrefix + folder + "/" + filename
+}
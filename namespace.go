@@ -0,0 +1,124 @@
+package statushub
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+)
+
+// NamespaceSeparator separates the components of
+// hierarchical service names, such as "mnist/run-3/train".
+const NamespaceSeparator = "/"
+
+// InNamespace checks if a service is inside a namespace,
+// or is the namespace itself.
+//
+// For example, "mnist/run-3/train" is in the namespaces
+// "mnist" and "mnist/run-3", but not in "mnist/run".
+// Every service is in the empty namespace.
+func InNamespace(service, namespace string) bool {
+	namespace = strings.TrimSuffix(namespace, NamespaceSeparator)
+	if namespace == "" {
+		return true
+	}
+	return service == namespace || strings.HasPrefix(service, namespace+NamespaceSeparator)
+}
+
+// ServiceNames gets service names matching an expression.
+//
+// The expression "*" matches every service.
+// Other expressions may be glob patterns, as in
+// path.Match, where "*" matches within a single level of
+// the namespace hierarchy (e.g. "mnist/*/train").
+// An expression without glob characters is returned as-is,
+// without checking that the service exists.
+func ServiceNames(c *Client, expr string) ([]string, error) {
+	if !strings.ContainsAny(expr, "*?[\\") {
+		return []string{expr}, nil
+	}
+	if _, err := path.Match(expr, ""); err != nil {
+		return nil, essentials.AddCtx("match services", err)
+	}
+	var serviceNames []string
+	overview, err := c.Overview()
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range overview {
+		if matched, _ := path.Match(expr, x.Service); matched || expr == "*" {
+			serviceNames = append(serviceNames, x.Service)
+		}
+	}
+	if len(serviceNames) == 0 {
+		return nil, errors.New("no services match: " + expr)
+	}
+	sort.Strings(serviceNames)
+	return serviceNames, nil
+}
+
+// A ServiceGroup summarizes the services in a namespace.
+type ServiceGroup struct {
+	// Namespace is the full name of the group, such as
+	// "mnist/run-3".
+	Namespace string `json:"namespace"`
+
+	// NumServices is the number of services in the group.
+	NumServices int `json:"numServices"`
+
+	// Latest is the most recent record from any service in
+	// the group.
+	Latest LogRecord `json:"latest"`
+
+	// MaxLevel is the highest MaxLevel of the overview
+	// records in the group.
+	MaxLevel Level `json:"maxLevel,omitempty"`
+}
+
+// GroupOverview groups the records of an overview by the
+// next namespace component below a parent namespace.
+//
+// For example, with the parent "mnist", the services
+// "mnist/run-3/train" and "mnist/run-3/eval" are grouped
+// into "mnist/run-3".
+// Services outside the parent namespace are ignored.
+//
+// The groups are sorted from most to least recent.
+func GroupOverview(overview []LogRecord, parent string) []ServiceGroup {
+	parent = strings.TrimSuffix(parent, NamespaceSeparator)
+	groups := map[string]*ServiceGroup{}
+	for _, record := range overview {
+		if !InNamespace(record.Service, parent) || record.Service == parent {
+			continue
+		}
+		rest := record.Service
+		prefix := ""
+		if parent != "" {
+			rest = rest[len(parent)+len(NamespaceSeparator):]
+			prefix = parent + NamespaceSeparator
+		}
+		name := prefix + strings.SplitN(rest, NamespaceSeparator, 2)[0]
+		group, ok := groups[name]
+		if !ok {
+			group = &ServiceGroup{Namespace: name, Latest: record}
+			groups[name] = group
+		}
+		group.NumServices++
+		if record.ID > group.Latest.ID {
+			group.Latest = record
+		}
+		if record.MaxLevel > group.MaxLevel {
+			group.MaxLevel = record.MaxLevel
+		}
+	}
+	res := make([]ServiceGroup, 0, len(groups))
+	for _, group := range groups {
+		res = append(res, *group)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Latest.ID > res[j].Latest.ID
+	})
+	return res
+}
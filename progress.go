@@ -0,0 +1,31 @@
+package statushub
+
+// Progress describes how far along a service is in a job
+// with a known amount of work.
+type Progress struct {
+	// Done is the amount of work completed so far.
+	Done float64 `json:"done"`
+
+	// Total is the total amount of work.
+	Total float64 `json:"total"`
+
+	// Time is the time of the latest update.
+	Time int64 `json:"time"`
+
+	// Rate is the estimated amount of work completed per
+	// second, or 0 if it is unknown.
+	Rate float64 `json:"rate,omitempty"`
+
+	// ETA is the estimated number of seconds until the
+	// work is complete, or 0 if it is unknown.
+	ETA float64 `json:"eta,omitempty"`
+}
+
+// Fraction returns the fraction of the work which has been
+// completed.
+func (p *Progress) Fraction() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+	return p.Done / p.Total
+}
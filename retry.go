@@ -0,0 +1,83 @@
+package statushub
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// A RetryPolicy controls how a Client retries API calls
+// which fail due to transient errors.
+//
+// Only idempotent calls are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times to try a
+	// call, including the first attempt.
+	// Values less than 2 disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the time to wait after the first
+	// failed attempt.
+	// It is doubled after every subsequent failure.
+	InitialBackoff time.Duration
+
+	// MaxBackoff bounds the time between attempts.
+	// If it is 0, the backoff is unbounded.
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy used by new
+// clients.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: time.Second / 2,
+	MaxBackoff:     time.Second * 10,
+}
+
+// Retry calls f until it succeeds, fails with a
+// non-transient error, or runs out of attempts.
+//
+// It returns early if the context is done.
+func (r RetryPolicy) Retry(ctx context.Context, f func() error) error {
+	backoff := r.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= r.MaxAttempts || !IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		backoff *= 2
+		if r.MaxBackoff != 0 && backoff > r.MaxBackoff {
+			backoff = r.MaxBackoff
+		}
+	}
+}
+
+// IsTransient checks if an error returned by a Client
+// might go away if the call were retried.
+//
+// This includes network errors, server-side failures,
+// and rate limiting.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError ||
+			statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
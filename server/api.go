@@ -0,0 +1,1130 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/unixpickle/statushub"
+)
+
+// GetPrefsAPI serves the API to view preferences.
+func (s *Server) GetPrefsAPI(w http.ResponseWriter, r *http.Request) {
+	if !s.processAPICall(w, r, nil) {
+		return
+	}
+	obj := map[string]interface{}{
+		"logSize":    s.Config.LogSize(),
+		"mediaCache": s.Config.MediaCache(),
+		"mediaQuota": s.Config.MediaQuota(),
+	}
+	s.servePayload(w, obj)
+}
+
+// SetPrefsAPI serves the API to set preferences.
+func (s *Server) SetPrefsAPI(w http.ResponseWriter, r *http.Request) {
+	var prefObj struct {
+		LogSize    int `json:"logSize"`
+		MediaCache int `json:"mediaCache"`
+
+		// MediaQuota is optional since the web UI does not
+		// set it.
+		MediaQuota *int64 `json:"mediaQuota"`
+	}
+	if !s.processAPICall(w, r, &prefObj) {
+		return
+	}
+
+	if err := s.Config.SetLogSize(prefObj.LogSize); err != nil {
+		s.serveError(w, "could not set log size")
+		return
+	}
+	s.Log.LogSizeUpdated()
+
+	if err := s.Config.SetMediaCache(prefObj.MediaCache); err != nil {
+		s.serveError(w, "could not set media cache")
+		return
+	}
+	if prefObj.MediaQuota != nil {
+		if err := s.Config.SetMediaQuota(*prefObj.MediaQuota); err != nil {
+			s.serveError(w, "could not set media quota")
+			return
+		}
+	}
+	s.Log.MediaCacheUpdated()
+
+	s.servePayload(w, true)
+}
+
+// ChpassAPI serves the API for password changing.
+func (s *Server) ChpassAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Old     string `json:"old"`
+		Confirm string `json:"confirm"`
+		New     string `json:"new"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	if obj.New != obj.Confirm {
+		s.serveError(w, "passwords do not match")
+		return
+	}
+	if !s.Config.CheckPass(obj.Old) {
+		s.serveError(w, "password incorrect")
+		return
+	}
+	if err := s.Config.SetPass(obj.New); err != nil {
+		s.serveError(w, "could not save settings")
+	} else {
+		s.servePayload(w, true)
+	}
+}
+
+// AddAPI serves the API for adding a log entry.
+func (s *Server) AddAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Service  string           `json:"service"`
+		Message  string           `json:"message"`
+		Level    statushub.Level  `json:"level"`
+		Labels   statushub.Labels `json:"labels"`
+		MediaIDs []int            `json:"mediaIDs"`
+		Key      string           `json:"key"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	entry := statushub.Entry{
+		Message:  obj.Message,
+		Level:    obj.Level,
+		Labels:   obj.Labels,
+		MediaIDs: obj.MediaIDs,
+	}
+	ids, err := s.Log.Add(obj.Service, obj.Key, []statushub.Entry{entry})
+	if err != nil {
+		s.serveError(w, err.Error())
+	} else {
+		s.servePayload(w, ids[0])
+	}
+}
+
+// AddBatchAPI serves the API for adding many log entries.
+//
+// The entries may be plain messages, or objects with
+// metadata such as a level.
+// Labels for the whole batch are merged into the labels
+// of each entry.
+func (s *Server) AddBatchAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Service  string            `json:"service"`
+		Messages []string          `json:"messages"`
+		Entries  []statushub.Entry `json:"entries"`
+		Labels   statushub.Labels  `json:"labels"`
+		Key      string            `json:"key"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	entries := obj.Entries
+	for _, msg := range obj.Messages {
+		entries = append(entries, statushub.Entry{Message: msg})
+	}
+	for i := range entries {
+		entries[i].Labels = obj.Labels.Merge(entries[i].Labels)
+	}
+	ids, err := s.Log.Add(obj.Service, obj.Key, entries)
+	if err != nil {
+		s.serveError(w, err.Error())
+	} else {
+		s.servePayload(w, ids)
+	}
+}
+
+// AddMediaAPI serves the API for adding a media entry.
+//
+// If a service is specified, a log record linking to the
+// media is also added to the service.
+// If a SHA-256 hash is specified, the upload fails unless
+// the data matches it.
+func (s *Server) AddMediaAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Service  string `json:"service"`
+		Folder   string `json:"folder"`
+		Filename string `json:"filename"`
+		Mime     string `json:"mime"`
+		Data     []byte `json:"data"`
+		Replace  bool   `json:"replace"`
+		SHA256   string `json:"sha256"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	id, err := s.Log.UploadMedia(&MediaUpload{
+		Folder:   obj.Folder,
+		Filename: obj.Filename,
+		Mime:     obj.Mime,
+		Replace:  obj.Replace,
+		Service:  obj.Service,
+		SHA256:   obj.SHA256,
+	}, bytes.NewReader(obj.Data))
+	if err != nil {
+		s.serveError(w, err.Error())
+	} else {
+		s.servePayload(w, id)
+	}
+}
+
+// UploadMediaAPI serves the API for adding a media entry
+// from a raw or multipart request body, which avoids
+// buffering and encoding the data as JSON.
+//
+// The entry is described by the "folder", "filename",
+// "mime", and "replace" query parameters, and the optional
+// "service" and "sha256" parameters work like in
+// AddMediaAPI.
+// For multipart bodies, these may instead be passed as
+// form fields before a "file" part containing the data.
+func (s *Server) UploadMediaAPI(w http.ResponseWriter, r *http.Request) {
+	disableCache(w)
+	if !s.authenticated(r) {
+		s.serveErrorCode(w, statushub.CodeNotAuthenticated, "not authenticated")
+		return
+	}
+	query := r.URL.Query()
+	upload := &MediaUpload{
+		Folder:   query.Get("folder"),
+		Filename: query.Get("filename"),
+		Mime:     query.Get("mime"),
+		Replace:  query.Get("replace") == "1",
+		Service:  query.Get("service"),
+		SHA256:   query.Get("sha256"),
+	}
+
+	var body io.Reader = r.Body
+	if multipart, err := r.MultipartReader(); err == nil {
+		body = nil
+		for {
+			part, err := multipart.NextPart()
+			if err == io.EOF {
+				s.serveError(w, "missing file part")
+				return
+			} else if err != nil {
+				s.serveError(w, err.Error())
+				return
+			}
+			if part.FormName() == "file" {
+				if upload.Filename == "" {
+					upload.Filename = part.FileName()
+				}
+				if upload.Mime == "" {
+					upload.Mime = part.Header.Get("Content-Type")
+				}
+				body = part
+				break
+			}
+			value, err := ioutil.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				s.serveError(w, err.Error())
+				return
+			}
+			switch part.FormName() {
+			case "service":
+				upload.Service = string(value)
+			case "folder":
+				upload.Folder = string(value)
+			case "filename":
+				upload.Filename = string(value)
+			case "mime":
+				upload.Mime = string(value)
+			case "replace":
+				upload.Replace = string(value) == "1" || string(value) == "true"
+			case "sha256":
+				upload.SHA256 = string(value)
+			}
+		}
+	} else if upload.Mime == "" {
+		upload.Mime = r.Header.Get("Content-Type")
+	}
+	if upload.Folder == "" || upload.Filename == "" {
+		s.serveError(w, "missing folder or filename")
+		return
+	}
+	if upload.Mime == "" {
+		upload.Mime = "application/octet-stream"
+	}
+
+	id, err := s.Log.UploadMedia(upload, body)
+	if err != nil {
+		s.serveError(w, err.Error())
+	} else {
+		s.servePayload(w, id)
+	}
+}
+
+// StartUploadAPI serves the API for starting a chunked
+// media upload.
+func (s *Server) StartUploadAPI(w http.ResponseWriter, r *http.Request) {
+	if !s.processAPICall(w, r, nil) {
+		return
+	}
+	id, err := s.Uploads.Start()
+	if err != nil {
+		s.serveError(w, err.Error())
+	} else {
+		s.servePayload(w, id)
+	}
+}
+
+// UploadChunkAPI serves the API for adding data to a
+// chunked upload.
+//
+// The request body is the raw chunk, and the "upload" and
+// "offset" query parameters identify where it belongs.
+// The response is the total size of the upload so far.
+func (s *Server) UploadChunkAPI(w http.ResponseWriter, r *http.Request) {
+	disableCache(w)
+	if !s.authenticated(r) {
+		s.serveErrorCode(w, statushub.CodeNotAuthenticated, "not authenticated")
+		return
+	}
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		s.serveError(w, "invalid offset")
+		return
+	}
+	size, err := s.Uploads.Append(r.URL.Query().Get("upload"), offset, r.Body)
+	if err != nil {
+		s.serveError(w, err.Error())
+	} else {
+		s.servePayload(w, size)
+	}
+}
+
+// UploadStatusAPI serves the API for checking the size of
+// a chunked upload, which is used to resume uploads.
+func (s *Server) UploadStatusAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Upload string `json:"upload"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	size, err := s.Uploads.Size(obj.Upload)
+	if err != nil {
+		s.serveError(w, err.Error())
+	} else {
+		s.servePayload(w, size)
+	}
+}
+
+// FinishUploadAPI serves the API for turning a chunked
+// upload into a media entry.
+//
+// If a size or SHA-256 hash is specified, the upload
+// fails unless the data matches it.
+func (s *Server) FinishUploadAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Upload   string `json:"upload"`
+		Service  string `json:"service"`
+		Folder   string `json:"folder"`
+		Filename string `json:"filename"`
+		Mime     string `json:"mime"`
+		Replace  bool   `json:"replace"`
+		Size     *int64 `json:"size"`
+		SHA256   string `json:"sha256"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	contents, size, err := s.Uploads.Finish(obj.Upload)
+	if err != nil {
+		s.serveError(w, err.Error())
+		return
+	}
+	defer contents.Close()
+	if obj.Size != nil && *obj.Size != size {
+		s.serveError(w, fmt.Sprintf("expected %d bytes but got %d", *obj.Size, size))
+		return
+	}
+	id, err := s.Log.UploadMedia(&MediaUpload{
+		Folder:   obj.Folder,
+		Filename: obj.Filename,
+		Mime:     obj.Mime,
+		Replace:  obj.Replace,
+		Service:  obj.Service,
+		SHA256:   obj.SHA256,
+	}, contents)
+	if err != nil {
+		s.serveError(w, err.Error())
+	} else {
+		s.servePayload(w, id)
+	}
+}
+
+// CancelUploadAPI serves the API for discarding a chunked
+// upload.
+func (s *Server) CancelUploadAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Upload string `json:"upload"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	if err := s.Uploads.Cancel(obj.Upload); err != nil {
+		s.serveError(w, err.Error())
+	} else {
+		s.servePayload(w, true)
+	}
+}
+
+// OverviewAPI serves the API for seeing the log overview.
+func (s *Server) OverviewAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Filter *statushub.LogFilter `json:"filter"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	s.serveLog(w, obj.Filter.Filter(s.Log.Overview()))
+}
+
+// GroupOverviewAPI serves the API for seeing the overview
+// grouped by namespace.
+func (s *Server) GroupOverviewAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Parent string               `json:"parent"`
+		Filter *statushub.LogFilter `json:"filter"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	overview := obj.Filter.Filter(s.Log.Overview())
+	s.servePayload(w, statushub.GroupOverview(overview, obj.Parent))
+}
+
+// ServiceLabelsAPI serves the API for getting the labels
+// of a service.
+func (s *Server) ServiceLabelsAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Service string `json:"service"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	s.servePayload(w, s.Log.ServiceLabels(obj.Service))
+}
+
+// SetServiceLabelsAPI serves the API for replacing the
+// labels of a service.
+func (s *Server) SetServiceLabelsAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Service string           `json:"service"`
+		Labels  statushub.Labels `json:"labels"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	s.Log.SetServiceLabels(obj.Service, obj.Labels)
+	s.servePayload(w, true)
+}
+
+// ServiceInfoAPI serves the API for getting the JSON
+// document attached to a service.
+func (s *Server) ServiceInfoAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Service string `json:"service"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	s.servePayload(w, s.Log.ServiceInfo(obj.Service))
+}
+
+// SetServiceInfoAPI serves the API for attaching a JSON
+// document to a service.
+func (s *Server) SetServiceInfoAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Service string          `json:"service"`
+		Info    json.RawMessage `json:"info"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	s.Log.SetServiceInfo(obj.Service, obj.Info)
+	s.servePayload(w, true)
+}
+
+// MediaOverviewAPI serves the API for seeing the media
+// overview.
+func (s *Server) MediaOverviewAPI(w http.ResponseWriter, r *http.Request) {
+	if !s.processAPICall(w, r, nil) {
+		return
+	}
+	s.serveMediaLog(w, s.Log.MediaOverview())
+}
+
+// FullLogAPI serves the API for seeing the entire log.
+func (s *Server) FullLogAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Filter *statushub.LogFilter `json:"filter"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	s.serveLog(w, obj.Filter.Filter(s.Log.FullLog()))
+}
+
+// ServiceLogAPI serves the API for seeing the log of a
+// specific service.
+func (s *Server) ServiceLogAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Service string               `json:"service"`
+		Filter  *statushub.LogFilter `json:"filter"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	records, err := s.Log.ServiceLog(obj.Service)
+	if err != nil {
+		s.serveLogError(w, err)
+	} else {
+		s.serveLog(w, obj.Filter.Filter(records))
+	}
+}
+
+// SetProgressAPI serves the API for reporting the
+// progress of a service.
+func (s *Server) SetProgressAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Service string  `json:"service"`
+		Done    float64 `json:"done"`
+		Total   float64 `json:"total"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	if err := s.Log.SetProgress(obj.Service, obj.Done, obj.Total); err != nil {
+		s.serveError(w, err.Error())
+	} else {
+		s.servePayload(w, true)
+	}
+}
+
+// CompareAPI serves the API for comparing the numeric
+// fields of multiple services.
+func (s *Server) CompareAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Services []string                  `json:"services"`
+		Options  *statushub.CompareOptions `json:"options"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	if len(obj.Services) == 0 {
+		s.serveError(w, "no services to compare")
+		return
+	}
+	logs := make([][]statushub.LogRecord, len(obj.Services))
+	for i, service := range obj.Services {
+		records, err := s.Log.ServiceLog(service)
+		if err != nil {
+			s.serveLogError(w, err)
+			return
+		}
+		logs[i] = records
+	}
+	s.servePayload(w, statushub.CompareRuns(obj.Services, logs, obj.Options))
+}
+
+// MediaLogAPI serves the API for seeing the log of a
+// media folder.
+func (s *Server) MediaLogAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Folder string `json:"folder"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	records, err := s.Log.MediaLog(obj.Folder)
+	if err != nil {
+		s.serveLogError(w, err)
+	} else {
+		s.serveMediaLog(w, records)
+	}
+}
+
+// MediaVersionsAPI serves the API for listing the versions
+// of a file in a media folder.
+func (s *Server) MediaVersionsAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Folder   string `json:"folder"`
+		Filename string `json:"filename"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	records, err := s.Log.MediaVersions(obj.Folder, obj.Filename)
+	if err != nil {
+		s.serveLogError(w, err)
+	} else {
+		s.serveMediaLog(w, records)
+	}
+}
+
+// MediaVersionAPI serves the API for looking up a version
+// of a file in a media folder.
+func (s *Server) MediaVersionAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Folder   string `json:"folder"`
+		Filename string `json:"filename"`
+		Version  int    `json:"version"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	record, err := s.Log.MediaVersion(obj.Folder, obj.Filename, obj.Version)
+	if err != nil {
+		s.serveLogError(w, err)
+	} else {
+		s.servePayload(w, record)
+	}
+}
+
+// MediaAPI serves the contents of a media item.
+func (s *Server) MediaViewAPI(w http.ResponseWriter, r *http.Request) {
+	disableCache(w)
+	if !s.authenticated(r) {
+		http.Error(w, "not authenticated", http.StatusForbidden)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	record, contents, err := s.Log.OpenMedia(id)
+	if errors.Is(err, errUnknownMedia) {
+		http.Error(w, "unknown media record", http.StatusNotFound)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		defer contents.Close()
+		disposition := "inline; filename*=UTF-8''" + url.PathEscape(record.Filename)
+		w.Header().Set("Content-Disposition", disposition)
+		w.Header().Set("Content-Type", record.Mime)
+		w.Header().Set("ETag", `"`+record.SHA256+`"`)
+		http.ServeContent(w, r, record.Filename, time.Unix(record.Time, 0), contents)
+	}
+}
+
+// MediaThumbAPI serves a thumbnail of an image media item.
+//
+// The "size" parameter is the maximum width and height of
+// the thumbnail, defaulting to DefaultThumbnailSize.
+// Images larger than MaxImagePixels are not supported.
+func (s *Server) MediaThumbAPI(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticated(r) {
+		disableCache(w)
+		http.Error(w, "not authenticated", http.StatusForbidden)
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	size := DefaultThumbnailSize
+	if sizeStr := r.FormValue("size"); sizeStr != "" {
+		size, err = strconv.Atoi(sizeStr)
+		if err != nil || size < 1 || size > MaxThumbnailSize {
+			http.Error(w, "invalid thumbnail size", http.StatusBadRequest)
+			return
+		}
+	}
+	record := s.Log.MediaRecord(id)
+	if record == nil {
+		http.Error(w, "unknown media record", http.StatusNotFound)
+		return
+	}
+	if !isImageMime(record.Mime) {
+		http.Error(w, "unsupported image type: "+record.Mime, http.StatusUnsupportedMediaType)
+		return
+	}
+	etag := `"` + record.SHA256 + "-" + strconv.Itoa(size) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	data, mime, err := s.Thumbnails.Thumbnail(record, size)
+	if errors.Is(err, errImageTooLarge) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mime)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// MediaDiffAPI serves a comparison of two media items,
+// given by the "a" and "b" parameters.
+//
+// Text media are compared with a unified diff.
+// Images are compared with an image of the per-pixel
+// differences, or placed next to each other if the "mode"
+// parameter is "side".
+// Images larger than MaxImagePixels are not supported.
+func (s *Server) MediaDiffAPI(w http.ResponseWriter, r *http.Request) {
+	disableCache(w)
+	if !s.authenticated(r) {
+		http.Error(w, "not authenticated", http.StatusForbidden)
+		return
+	}
+	var ids [2]int
+	for i, name := range []string{"a", "b"} {
+		var err error
+		ids[i], err = strconv.Atoi(r.FormValue(name))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	mode := r.FormValue("mode")
+	if mode != "" && mode != "diff" && mode != "side" {
+		http.Error(w, "unknown diff mode: "+mode, http.StatusBadRequest)
+		return
+	}
+
+	var records [2]*MediaRecord
+	for i, id := range ids {
+		records[i] = s.Log.MediaRecord(id)
+		if records[i] == nil {
+			http.Error(w, "unknown media record", http.StatusNotFound)
+			return
+		}
+	}
+	if isTextMime(records[0].Mime) && isTextMime(records[1].Mime) {
+		s.serveTextDiff(w, records)
+	} else if isImageMime(records[0].Mime) && isImageMime(records[1].Mime) {
+		s.serveImageDiff(w, records, mode)
+	} else {
+		http.Error(w, "cannot compare "+records[0].Mime+" with "+records[1].Mime,
+			http.StatusUnsupportedMediaType)
+	}
+}
+
+func (s *Server) serveTextDiff(w http.ResponseWriter, records [2]*MediaRecord) {
+	var texts, names [2]string
+	for i, record := range records {
+		if record.Size > MaxDiffSize {
+			http.Error(w, "media too large to diff", http.StatusBadRequest)
+			return
+		}
+		_, contents, err := s.Log.OpenMedia(record.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		data, err := ioutil.ReadAll(contents)
+		contents.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		texts[i] = string(data)
+		names[i] = fmt.Sprintf("%s/%s (version %d)", record.Folder, record.Filename,
+			record.Version)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(unifiedDiff(names[0], names[1], texts[0], texts[1])))
+}
+
+func (s *Server) serveImageDiff(w http.ResponseWriter, records [2]*MediaRecord, mode string) {
+	var images [2]image.Image
+	for i, record := range records {
+		_, contents, err := s.Log.OpenMedia(record.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		images[i], err = decodeImage(contents, record.Mime)
+		contents.Close()
+		if errors.Is(err, errImageTooLarge) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	var res image.Image
+	if mode == "side" {
+		res = imageSideBySide(images[0], images[1])
+	} else {
+		var changed int
+		res, changed = imageDifference(images[0], images[1])
+		w.Header().Set("X-Changed-Pixels", strconv.Itoa(changed))
+	}
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, res)
+}
+
+// ExportAPI serves an archive of every service, record,
+// and media record.
+func (s *Server) ExportAPI(w http.ResponseWriter, r *http.Request) {
+	disableCache(w)
+	if !s.authenticated(r) {
+		http.Error(w, "not authenticated", http.StatusForbidden)
+		return
+	}
+	filename := "statushub-" + time.Now().Format("20060102-150405") + ".tar"
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.Header().Set("Content-Type", "application/x-tar")
+	s.Log.Export(w)
+}
+
+// ImportAPI serves the API for importing an archive from
+// ExportAPI.
+//
+// The request body is the archive itself, and the import
+// options are passed as the "replace" and "remap" query
+// parameters.
+func (s *Server) ImportAPI(w http.ResponseWriter, r *http.Request) {
+	disableCache(w)
+	if !s.authenticated(r) {
+		s.serveErrorCode(w, statushub.CodeNotAuthenticated, "not authenticated")
+		return
+	}
+	opts := statushub.ImportOptions{
+		Replace:  r.URL.Query().Get("replace") == "1",
+		RemapIDs: r.URL.Query().Get("remap") == "1",
+	}
+	stats, err := s.Log.Import(r.Body, opts)
+	if err != nil {
+		s.serveError(w, err.Error())
+	} else {
+		s.servePayload(w, stats)
+	}
+}
+
+// DeleteAPI serves the API for deleting services.
+func (s *Server) DeleteAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Service string `json:"service"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	if err := s.Log.DeleteService(obj.Service); err != nil {
+		s.serveLogError(w, err)
+	} else {
+		s.servePayload(w, true)
+	}
+}
+
+// DeleteNamespaceAPI serves the API for deleting every
+// service in a namespace.
+//
+// Unless the request is confirmed, nothing is deleted and
+// the services which would be deleted are returned.
+func (s *Server) DeleteNamespaceAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Namespace string `json:"namespace"`
+		Confirm   bool   `json:"confirm"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	names, err := s.Log.DeleteNamespace(obj.Namespace, !obj.Confirm)
+	if err != nil {
+		s.serveLogError(w, err)
+	} else {
+		s.servePayload(w, names)
+	}
+}
+
+// DeleteMediaAPI serves the API for deleting media.
+func (s *Server) DeleteMediaAPI(w http.ResponseWriter, r *http.Request) {
+	var obj struct {
+		Folder string `json:"folder"`
+	}
+	if !s.processAPICall(w, r, &obj) {
+		return
+	}
+	if err := s.Log.DeleteMedia(obj.Folder); err != nil {
+		s.serveLogError(w, err)
+	} else {
+		s.servePayload(w, true)
+	}
+}
+
+// ServiceStreamAPI serves a stream of messages for a
+// particular service.
+func (s *Server) ServiceStreamAPI(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticated(r) {
+		s.serveErrorCode(w, statushub.CodeNotAuthenticated, "not authenticated")
+		return
+	}
+	filter, err := statushub.ParseLogFilterQuery(r.URL.Query())
+	if err != nil {
+		s.serveError(w, err.Error())
+		return
+	}
+	service := r.FormValue("service")
+	s.serveStream(w, r, s.Config.LogSize(), func() <-chan struct{} {
+		return s.Log.WaitService(service)
+	}, func() []statushub.LogRecord {
+		res, _ := s.Log.ServiceLog(service)
+		return filter.Filter(res)
+	})
+}
+
+// FullStreamAPI serves a stream of messages for all
+// services.
+func (s *Server) FullStreamAPI(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticated(r) {
+		s.serveErrorCode(w, statushub.CodeNotAuthenticated, "not authenticated")
+		return
+	}
+	filter, err := statushub.ParseLogFilterQuery(r.URL.Query())
+	if err != nil {
+		s.serveError(w, err.Error())
+		return
+	}
+	s.serveStream(w, r, 0, func() <-chan struct{} {
+		return s.Log.Wait()
+	}, func() []statushub.LogRecord {
+		return filter.Filter(s.Log.FullLog())
+	})
+}
+
+func (s *Server) processAPICall(w http.ResponseWriter, r *http.Request, inData interface{}) bool {
+	disableCache(w)
+	if !s.authenticated(r) {
+		if pass := r.FormValue("password"); pass != "" {
+			// Allow authentication without a cookie.
+			limitID := s.LimitNamer.Name(r)
+			if s.LoginLimit.Get(limitID) < 0 {
+				s.serveErrorCode(w, statushub.CodeRateLimited, "too many login attempts")
+				return false
+			}
+			if !s.Config.CheckPass(pass) {
+				s.LoginLimit.Decrement(limitID)
+				s.serveErrorCode(w, statushub.CodeNotAuthenticated, "incorrect password")
+				return false
+			}
+		} else {
+			s.serveErrorCode(w, statushub.CodeNotAuthenticated, "not authenticated")
+			return false
+		}
+	}
+	if inData != nil {
+		contents, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return false
+		}
+		// Some clients send no body for calls without
+		// required arguments.
+		if len(contents) > 0 {
+			if err := json.Unmarshal(contents, inData); err != nil {
+				s.serveError(w, "JSON unmarshal: "+err.Error())
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *Server) serveLog(w http.ResponseWriter, l []statushub.LogRecord) {
+	if l == nil {
+		s.servePayload(w, []statushub.LogRecord{})
+	} else {
+		s.servePayload(w, l)
+	}
+}
+
+func (s *Server) serveMediaLog(w http.ResponseWriter, l []statushub.MediaRecord) {
+	if l == nil {
+		s.servePayload(w, []statushub.MediaRecord{})
+	} else {
+		s.servePayload(w, l)
+	}
+}
+
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request, maxEntries int,
+	getWait func() <-chan struct{}, getEntries func() []statushub.LogRecord) {
+	u := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			originStr := r.Header.Get("origin")
+			if originStr == "" {
+				// Must be a command-line tool, not a web client.
+				return true
+			}
+			origin, err := url.Parse(originStr)
+			if err != nil {
+				return false
+			}
+			origHost := r.Header.Get("Host")
+			if forwardHeader := r.Header.Get("X-Forwarded-Host"); forwardHeader != "" {
+				hosts := strings.Split(forwardHeader, ",")
+				if len(hosts) >= s.LimitNamer.NumProxies {
+					origHost = strings.TrimSpace(hosts[len(hosts)-s.LimitNamer.NumProxies])
+				}
+			}
+			if origHost == "" {
+				// This seems to happen on localhost.
+				return true
+			}
+			return origin.Host == origHost
+		},
+	}
+	conn, err := u.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	connDead := make(chan struct{})
+	go func() {
+		var obj interface{}
+		for {
+			if conn.ReadJSON(&obj) != nil {
+				close(connDead)
+				return
+			}
+		}
+	}()
+
+	send := func(record statushub.LogRecord, update bool) bool {
+		var msg struct {
+			statushub.LogRecord
+			Limit int `json:"limit,omitempty"`
+		}
+		msg.LogRecord = record
+		msg.Progress = s.Log.Progress(record.Service)
+		msg.Update = update
+		msg.Limit = maxEntries
+		return conn.WriteJSON(msg) == nil
+	}
+
+	// sentProgress stores the progress last sent for each
+	// service, so that records can be re-sent when only
+	// the progress changes.
+	sentProgress := map[string]*statushub.Progress{}
+	progressChanged := func(service string) bool {
+		progress := s.Log.Progress(service)
+		last, ok := sentProgress[service]
+		sentProgress[service] = progress
+		if !ok || progress == nil {
+			return false
+		}
+		return last == nil || *last != *progress
+	}
+
+	greatestID := 0
+	first := true
+	for {
+		ch := getWait()
+		entries := getEntries()
+		if first {
+			first = false
+			if len(entries) == 0 {
+				greatestID = -1
+			} else {
+				greatestID = entries[0].ID
+			}
+			for _, entry := range entries {
+				if _, ok := sentProgress[entry.Service]; !ok {
+					sentProgress[entry.Service] = s.Log.Progress(entry.Service)
+				}
+			}
+		} else if len(entries) == 0 {
+			// The log was cleared.
+			greatestID = -1
+		} else {
+			startIdx := -1
+			for startIdx+1 < len(entries) && entries[startIdx+1].ID > greatestID {
+				startIdx++
+			}
+			for i := startIdx; i >= 0; i-- {
+				sentProgress[entries[i].Service] = s.Log.Progress(entries[i].Service)
+				if !send(entries[i], false) {
+					return
+				}
+			}
+			greatestID = entries[0].ID
+
+			// Re-send the latest record of every service
+			// whose progress changed without a new record.
+			seen := map[string]bool{}
+			for _, entry := range entries {
+				if seen[entry.Service] {
+					continue
+				}
+				seen[entry.Service] = true
+				if progressChanged(entry.Service) && !send(entry, true) {
+					return
+				}
+			}
+		}
+		select {
+		case <-ch:
+		case <-connDead:
+			return
+		}
+	}
+}
+
+func (s *Server) serveError(w http.ResponseWriter, msg string) {
+	s.serveErrorCode(w, "", msg)
+}
+
+// serveErrorCode serves an error with a machine-readable
+// code, such as statushub.CodeUnknownService.
+func (s *Server) serveErrorCode(w http.ResponseWriter, code, msg string) {
+	pkt := map[string]string{"error": msg}
+	if code != "" {
+		pkt["code"] = code
+	}
+	data, _ := json.Marshal(pkt)
+	w.Write(data)
+}
+
+// serveLogError serves an error returned by the Log.
+func (s *Server) serveLogError(w http.ResponseWriter, err error) {
+	var code string
+	if errors.Is(err, errUnknownService) {
+		code = statushub.CodeUnknownService
+	} else if errors.Is(err, errUnknownMedia) {
+		code = statushub.CodeUnknownMedia
+	}
+	s.serveErrorCode(w, code, err.Error())
+}
+
+func (s *Server) servePayload(w http.ResponseWriter, msg interface{}) {
+	pkt := map[string]interface{}{"data": msg}
+	data, err := json.Marshal(pkt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		w.Write(data)
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/unixpickle/statushub"
+)
+
+const testPassword = "password"
+
+func newTestServer(t *testing.T) *Server {
+	blobs, err := NewBlobStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(NewConfig(testPassword), blobs, "", 0)
+}
+
+func addTestRecord(t *testing.T, s *Server, service, message string) {
+	if _, err := s.Log.Add(service, "", []statushub.Entry{{Message: message}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testBodilessCall makes a GET request with no body, like
+// the Fitbit and Android clients do, and returns the
+// messages of the resulting log records.
+func testBodilessCall(t *testing.T, s *Server, path string) []string {
+	req := httptest.NewRequest("GET", path+"?password="+testPassword, nil)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	var resp struct {
+		Data []struct {
+			Message string `json:"message"`
+		} `json:"data"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "" {
+		t.Fatalf("unexpected error: %s", resp.Error)
+	}
+	var messages []string
+	for _, record := range resp.Data {
+		messages = append(messages, record.Message)
+	}
+	return messages
+}
+
+func TestOverviewAPIWithoutBody(t *testing.T) {
+	s := newTestServer(t)
+	addTestRecord(t, s, "a", "hello")
+	addTestRecord(t, s, "b", "world")
+	messages := testBodilessCall(t, s, "/api/overview")
+	if len(messages) != 2 {
+		t.Errorf("expected 2 records but got %v", messages)
+	}
+}
+
+func TestFullLogAPIWithoutBody(t *testing.T) {
+	s := newTestServer(t)
+	addTestRecord(t, s, "a", "hello")
+	addTestRecord(t, s, "a", "world")
+	messages := testBodilessCall(t, s, "/api/fullLog")
+	if len(messages) != 2 || messages[0] != "world" || messages[1] != "hello" {
+		t.Errorf("unexpected records: %v", messages)
+	}
+}
@@ -0,0 +1,491 @@
+package server
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+)
+
+// Export writes the services, records, and media of the
+// log to an archive in the format described by
+// statushub.ArchiveVersion.
+func (l *Log) Export(w io.Writer) (err error) {
+	defer essentials.AddCtxTo("export", &err)
+
+	l.logLock.RLock()
+
+	// A service may have metadata before it has records,
+	// e.g. if it reported its info before logging.
+	serviceNames := map[string]bool{}
+	for name := range l.perService {
+		serviceNames[name] = true
+	}
+	for name := range l.labels {
+		serviceNames[name] = true
+	}
+	for name := range l.info {
+		serviceNames[name] = true
+	}
+	for name := range l.progress {
+		serviceNames[name] = true
+	}
+
+	var services []statushub.ArchiveService
+	var records []statushub.LogRecord
+	for name := range serviceNames {
+		services = append(services, statushub.ArchiveService{
+			Service:  name,
+			Labels:   l.labels[name],
+			Info:     l.info[name],
+			Progress: l.serviceProgress(name),
+		})
+		records = append(records, l.perService[name]...)
+	}
+	var media []MediaRecord
+	for _, folder := range l.media {
+		media = append(media, folder.Records()...)
+	}
+	l.logLock.RUnlock()
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Service < services[j].Service
+	})
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+	sort.Slice(media, func(i, j int) bool {
+		return media[i].ID < media[j].ID
+	})
+
+	tw := tar.NewWriter(w)
+	manifest := statushub.ArchiveManifest{
+		Version: statushub.ArchiveVersion,
+		Time:    time.Now().Unix(),
+	}
+	if err := writeArchiveJSON(tw, "manifest.json", manifest); err != nil {
+		return err
+	}
+	if err := writeArchiveNDJSON(tw, "services.ndjson", len(services), func(i int) interface{} {
+		return services[i]
+	}); err != nil {
+		return err
+	}
+	if err := writeArchiveNDJSON(tw, "records.ndjson", len(records), func(i int) interface{} {
+		return records[i]
+	}); err != nil {
+		return err
+	}
+
+	// Media may be deleted while we export it, so we only
+	// list the media whose contents we could write.
+	var written []statushub.MediaRecord
+	for _, record := range media {
+		blob, err := l.blobs.Open(record.SHA256)
+		if err != nil {
+			continue
+		}
+		err = writeArchiveBlob(tw, "media/"+strconv.Itoa(record.ID), blob)
+		blob.Close()
+		if err != nil {
+			return err
+		}
+		written = append(written, record.MediaRecord)
+	}
+	if err := writeArchiveNDJSON(tw, "media.ndjson", len(written), func(i int) interface{} {
+		return written[i]
+	}); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// Import reads an archive produced by Export and adds its
+// contents to the log.
+//
+// The archive is fully read and validated before the log
+// is modified.
+func (l *Log) Import(r io.Reader, opts statushub.ImportOptions) (*statushub.ImportStats, error) {
+	archive, err := readArchive(r, l.blobs)
+	if err != nil {
+		return nil, essentials.AddCtx("read archive", err)
+	}
+	for i, record := range archive.Media {
+		if record.Width == 0 {
+			// Archives from older servers lack dimensions.
+			width, height := imageSize(l.blobs, record.SHA256, record.Mime)
+			archive.Media[i].Width, archive.Media[i].Height = width, height
+		}
+	}
+
+	logSize := l.config.LogSize()
+	cacheSize := l.config.MediaCache()
+	quota := l.config.MediaQuota()
+
+	l.logLock.Lock()
+	defer l.logLock.Unlock()
+
+	if opts.Replace {
+		for _, folder := range l.media {
+			for _, record := range folder.Records() {
+				l.blobs.Release(record.SHA256)
+			}
+		}
+		for name := range l.perService {
+			l.wakeListeners(name)
+		}
+		l.perService = map[string][]statushub.LogRecord{}
+		l.allRecords = nil
+		l.media = map[string]*mediaFolder{}
+		l.mediaIndex = map[int]string{}
+		l.keys = map[string]*keyCache{}
+		l.labels = map[string]statushub.Labels{}
+		l.info = map[string]json.RawMessage{}
+		l.progress = map[string]*progressTracker{}
+	}
+
+	if opts.RemapIDs {
+		archive.RemapIDs(l.curID)
+	} else if err := l.checkIDCollisions(archive); err != nil {
+		for _, record := range archive.Media {
+			l.blobs.Release(record.SHA256)
+		}
+		return nil, err
+	}
+
+	for _, service := range archive.Services {
+		if len(service.Labels) > 0 {
+			l.labels[service.Service] = service.Labels
+		}
+		if len(service.Info) > 0 {
+			l.info[service.Service] = service.Info
+		}
+		if p := service.Progress; p != nil && p.Total > 0 && p.Done >= 0 {
+			tracker := &progressTracker{}
+			tracker.Update(p.Done, p.Total, time.Unix(p.Time, 0))
+			l.progress[service.Service] = tracker
+		}
+	}
+	for _, record := range archive.Records {
+		l.perService[record.Service] = append(l.perService[record.Service], record)
+		l.allRecords = append(l.allRecords, record)
+		if record.ID >= l.curID {
+			l.curID = record.ID + 1
+		}
+	}
+	newMedia := map[string][]MediaRecord{}
+	for _, record := range archive.Media {
+		newMedia[record.Folder] = append(newMedia[record.Folder], record)
+		if record.ID >= l.curID {
+			l.curID = record.ID + 1
+		}
+	}
+
+	sortRecords(l.allRecords)
+	l.allRecords = trimLog(l.allRecords, logSize)
+	for name, records := range l.perService {
+		sortRecords(records)
+		l.perService[name] = trimLog(records, logSize)
+		l.wakeListeners(name)
+	}
+	for name, records := range newMedia {
+		// Imported IDs may be interleaved with existing IDs,
+		// so the folder is rebuilt in sorted order.
+		if folder, ok := l.media[name]; ok {
+			records = append(records, folder.Records()...)
+			delete(l.media, name)
+		}
+		sort.SliceStable(records, func(i, j int) bool {
+			return records[i].ID < records[j].ID
+		})
+		for _, record := range records {
+			l.addMedia(record)
+		}
+		l.trimMedia(name, cacheSize)
+	}
+	l.enforceMediaQuota(quota, -1)
+
+	return &statushub.ImportStats{
+		Services: len(archive.Services),
+		Records:  len(archive.Records),
+		Media:    len(archive.Media),
+	}, nil
+}
+
+func (l *Log) checkIDCollisions(archive *logArchive) error {
+	ids := map[int]bool{}
+	for _, records := range l.perService {
+		for _, record := range records {
+			ids[record.ID] = true
+		}
+	}
+	for id := range l.mediaIndex {
+		ids[id] = true
+	}
+	for _, record := range archive.Records {
+		if ids[record.ID] {
+			return fmt.Errorf("record ID %d already exists", record.ID)
+		}
+	}
+	for _, record := range archive.Media {
+		if ids[record.ID] {
+			return fmt.Errorf("media ID %d already exists", record.ID)
+		}
+	}
+	return nil
+}
+
+// A logArchive is the decoded contents of an archive.
+type logArchive struct {
+	Services []statushub.ArchiveService
+	Records  []statushub.LogRecord
+	Media    []MediaRecord
+}
+
+// archiveBlob is the stored contents of a media entry in
+// an archive.
+type archiveBlob struct {
+	Hash string
+	Size int64
+}
+
+// readArchive decodes an archive, storing the contents of
+// its media in a BlobStore as they are read, so that large
+// archives are not buffered in memory.
+//
+// If reading succeeds, each media record holds one
+// reference to its blob.
+// Otherwise, no references to new blobs are kept.
+func readArchive(r io.Reader, blobs *BlobStore) (*logArchive, error) {
+	res := &logArchive{}
+	stored := map[int]archiveBlob{}
+	success := false
+	defer func() {
+		for _, blob := range stored {
+			blobs.Release(blob.Hash)
+		}
+		if !success {
+			for _, record := range res.Media {
+				if record.SHA256 != "" {
+					blobs.Release(record.SHA256)
+				}
+			}
+		}
+	}()
+
+	tr := tar.NewReader(r)
+	var manifest *statushub.ArchiveManifest
+
+	// The hashes in the archive are only used to verify
+	// the data, since SHA256 marks the blobs we own.
+	var expected []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if manifest == nil && header.Name != "manifest.json" {
+			return nil, errors.New("archive does not start with a manifest")
+		}
+		switch header.Name {
+		case "manifest.json":
+			manifest = &statushub.ArchiveManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, essentials.AddCtx("read manifest", err)
+			}
+			if manifest.Version < 1 || manifest.Version > statushub.ArchiveVersion {
+				return nil, fmt.Errorf("unsupported archive version: %d", manifest.Version)
+			}
+		case "services.ndjson":
+			err = readArchiveNDJSON(tr, func(dec *json.Decoder) error {
+				var service statushub.ArchiveService
+				if err := dec.Decode(&service); err != nil {
+					return err
+				}
+				res.Services = append(res.Services, service)
+				return nil
+			})
+		case "records.ndjson":
+			err = readArchiveNDJSON(tr, func(dec *json.Decoder) error {
+				var record statushub.LogRecord
+				if err := dec.Decode(&record); err != nil {
+					return err
+				}
+				res.Records = append(res.Records, record)
+				return nil
+			})
+		case "media.ndjson":
+			err = readArchiveNDJSON(tr, func(dec *json.Decoder) error {
+				var record MediaRecord
+				if err := dec.Decode(&record.MediaRecord); err != nil {
+					return err
+				}
+				expected = append(expected, record.SHA256)
+				record.SHA256 = ""
+				res.Media = append(res.Media, record)
+				return nil
+			})
+		default:
+			if path.Dir(header.Name) != "media" {
+				return nil, errors.New("unexpected archive entry: " + header.Name)
+			}
+			id, err := strconv.Atoi(path.Base(header.Name))
+			if err != nil {
+				return nil, errors.New("unexpected archive entry: " + header.Name)
+			}
+			hash, size, err := blobs.Put(tr)
+			if err != nil {
+				return nil, err
+			}
+			if old, ok := stored[id]; ok {
+				blobs.Release(old.Hash)
+			}
+			stored[id] = archiveBlob{Hash: hash, Size: size}
+		}
+		if err != nil {
+			return nil, essentials.AddCtx("read "+header.Name, err)
+		}
+	}
+	if manifest == nil {
+		return nil, errors.New("archive is missing a manifest")
+	}
+
+	// Each record takes ownership of its blob, so that the
+	// deferred cleanup releases every blob exactly once.
+	for i := range res.Media {
+		record := &res.Media[i]
+		blob, ok := stored[record.ID]
+		if !ok {
+			return nil, fmt.Errorf("archive is missing data for media %d", record.ID)
+		}
+		delete(stored, record.ID)
+		record.SHA256 = blob.Hash
+		record.Size = blob.Size
+		if expected[i] != "" && expected[i] != blob.Hash {
+			return nil, fmt.Errorf("%w: archive data for media %d is corrupt",
+				errChecksumMismatch, record.ID)
+		}
+	}
+	success = true
+	return res, nil
+}
+
+// RemapIDs assigns consecutive IDs to the records and
+// media, starting at firstID, while preserving their
+// relative order.
+//
+// Links from records to media are updated, and links to
+// media which are not in the archive are dropped.
+func (l *logArchive) RemapIDs(firstID int) {
+	oldMediaIDs := make([]int, len(l.Media))
+	var ids []*int
+	for i := range l.Records {
+		ids = append(ids, &l.Records[i].ID)
+	}
+	for i := range l.Media {
+		oldMediaIDs[i] = l.Media[i].ID
+		ids = append(ids, &l.Media[i].ID)
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return *ids[i] < *ids[j]
+	})
+	for i, id := range ids {
+		*id = firstID + i
+	}
+
+	mediaIDs := map[int]int{}
+	for i, oldID := range oldMediaIDs {
+		mediaIDs[oldID] = l.Media[i].ID
+	}
+	for i, record := range l.Records {
+		var newIDs []int
+		for _, oldID := range record.MediaIDs {
+			if newID, ok := mediaIDs[oldID]; ok {
+				newIDs = append(newIDs, newID)
+			}
+		}
+		l.Records[i].MediaIDs = newIDs
+	}
+}
+
+func sortRecords(records []statushub.LogRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+}
+
+func writeArchiveJSON(tw *tar.Writer, name string, obj interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return writeArchiveFile(tw, name, data)
+}
+
+func writeArchiveNDJSON(tw *tar.Writer, name string, n int, obj func(i int) interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := 0; i < n; i++ {
+		if err := enc.Encode(obj(i)); err != nil {
+			return err
+		}
+	}
+	return writeArchiveFile(tw, name, buf.Bytes())
+}
+
+func writeArchiveFile(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func writeArchiveBlob(tw *tar.Writer, name string, blob io.ReadSeeker) error {
+	size, err := blob.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := blob.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, blob, size)
+	return err
+}
+
+func readArchiveNDJSON(r io.Reader, decode func(dec *json.Decoder) error) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for dec.More() {
+		if err := decode(dec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/unixpickle/essentials"
+)
+
+var blobNameExp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// A BlobStore stores media contents keyed by their SHA-256
+// hash, so that identical contents are only stored once.
+//
+// Blobs are reference counted: every Put of a blob must be
+// matched by a Release once the blob is no longer needed.
+type BlobStore struct {
+	dir string
+
+	lock      sync.Mutex
+	refs      map[string]int
+	sizes     map[string]int64
+	memory    map[string][]byte
+	totalSize int64
+}
+
+// NewBlobStore creates a BlobStore which stores blobs in a
+// directory, creating the directory if necessary.
+//
+// Media metadata is not persisted across restarts, so any
+// blobs left in the directory by a previous run are
+// deleted.
+//
+// If dir is empty, blobs are kept in memory.
+func NewBlobStore(dir string) (*BlobStore, error) {
+	res := &BlobStore{
+		dir:   dir,
+		refs:  map[string]int{},
+		sizes: map[string]int64{},
+	}
+	if dir == "" {
+		res.memory = map[string][]byte{}
+		return res, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, essentials.AddCtx("create blob store", err)
+	}
+	if err := res.removeStale(); err != nil {
+		return nil, essentials.AddCtx("create blob store", err)
+	}
+	return res, nil
+}
+
+// Put stores the contents of r and returns the blob's hash
+// and size.
+func (b *BlobStore) Put(r io.Reader) (hash string, size int64, err error) {
+	defer essentials.AddCtxTo("store blob", &err)
+	if b.memory != nil {
+		return b.putMemory(r)
+	}
+
+	tmp, err := ioutil.TempFile(b.dir, "upload-")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	hasher := sha256.New()
+	size, err = io.Copy(io.MultiWriter(tmp, hasher), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	hash = hex.EncodeToString(hasher.Sum(nil))
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.refs[hash] == 0 {
+		blobPath := b.path(hash)
+		if err := os.MkdirAll(filepath.Dir(blobPath), 0700); err != nil {
+			return "", 0, err
+		}
+		if err := os.Rename(tmp.Name(), blobPath); err != nil {
+			return "", 0, err
+		}
+		b.sizes[hash] = size
+		b.totalSize += size
+	}
+	b.refs[hash]++
+	return hash, size, nil
+}
+
+// Open opens a blob for reading.
+// The caller must close the result.
+func (b *BlobStore) Open(hash string) (io.ReadSeekCloser, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.refs[hash] == 0 {
+		return nil, errors.New("open blob: unknown blob " + hash)
+	}
+	if b.memory != nil {
+		return nopSeekCloser{bytes.NewReader(b.memory[hash])}, nil
+	}
+	f, err := os.Open(b.path(hash))
+	if err != nil {
+		return nil, essentials.AddCtx("open blob", err)
+	}
+	return f, nil
+}
+
+// Read reads the entire contents of a blob.
+func (b *BlobStore) Read(hash string) ([]byte, error) {
+	r, err := b.Open(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Release removes one reference to a blob, deleting the
+// blob once it has no references.
+func (b *BlobStore) Release(hash string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.refs[hash] == 0 {
+		return
+	}
+	b.refs[hash]--
+	if b.refs[hash] > 0 {
+		return
+	}
+	delete(b.refs, hash)
+	b.totalSize -= b.sizes[hash]
+	delete(b.sizes, hash)
+	if b.memory != nil {
+		delete(b.memory, hash)
+	} else {
+		os.Remove(b.path(hash))
+	}
+}
+
+// TotalSize returns the number of bytes used by all of the
+// stored blobs.
+func (b *BlobStore) TotalSize() int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.totalSize
+}
+
+func (b *BlobStore) putMemory(r io.Reader) (string, int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", 0, err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	size := int64(len(data))
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.refs[hash] == 0 {
+		b.memory[hash] = data
+		b.sizes[hash] = size
+		b.totalSize += size
+	}
+	b.refs[hash]++
+	return hash, size, nil
+}
+
+func (b *BlobStore) path(hash string) string {
+	return filepath.Join(b.dir, hash[:2], hash)
+}
+
+// removeStale deletes blobs and partial uploads from the
+// blob directory, leaving unrelated files alone.
+func (b *BlobStore) removeStale() error {
+	listing, err := ioutil.ReadDir(b.dir)
+	if err != nil {
+		return err
+	}
+	for _, item := range listing {
+		name := item.Name()
+		if !item.IsDir() {
+			if matched, _ := filepath.Match("upload-*", name); matched {
+				os.Remove(filepath.Join(b.dir, name))
+			}
+			continue
+		}
+		if len(name) != 2 {
+			continue
+		}
+		subDir := filepath.Join(b.dir, name)
+		subListing, err := ioutil.ReadDir(subDir)
+		if err != nil {
+			return err
+		}
+		for _, blob := range subListing {
+			if blobNameExp.MatchString(blob.Name()) && blob.Name()[:2] == name {
+				if err := os.Remove(filepath.Join(subDir, blob.Name())); err != nil {
+					return err
+				}
+			}
+		}
+		os.Remove(subDir)
+	}
+	return nil
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (n nopSeekCloser) Close() error {
+	return nil
+}
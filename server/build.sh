@@ -0,0 +1,4 @@
+#!/bin/bash
+
+cd assets && ./build.sh && cd ..
+go-bindata-assetfs -pkg server -fs assets/images/*.svg assets/*.html assets/style/style.css assets/script/script.js assets/script/deps.js
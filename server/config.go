@@ -1,4 +1,4 @@
-package main
+package server
 
 import (
 	"crypto/sha512"
@@ -23,6 +23,10 @@ const DefaultLogSize = 1000
 // backlog.
 const DefaultMediaCache = 10000000
 
+// DefaultMediaQuota is the default limit on the number of
+// bytes of media stored on disk across all folders.
+const DefaultMediaQuota = 1000000000
+
 // Config manages the server settings.
 // It automatically deals with concurrency issues, saving,
 // loading, and prompting the user for new values.
@@ -47,6 +51,7 @@ func LoadConfig(path string) (*Config, error) {
 				PasswordHash: hashPassword(string(pass)),
 				LogSize:      DefaultLogSize,
 				MediaCache:   DefaultMediaCache,
+				MediaQuota:   DefaultMediaQuota,
 			},
 			path: path,
 		}
@@ -62,6 +67,20 @@ func LoadConfig(path string) (*Config, error) {
 	return res, nil
 }
 
+// NewConfig creates an in-memory configuration with the
+// given password and default settings.
+// Changes to the configuration are not saved.
+func NewConfig(password string) *Config {
+	return &Config{
+		cfg: &configData{
+			PasswordHash: hashPassword(password),
+			LogSize:      DefaultLogSize,
+			MediaCache:   DefaultMediaCache,
+			MediaQuota:   DefaultMediaQuota,
+		},
+	}
+}
+
 // CheckPass checks if the given password is correct.
 func (c *Config) CheckPass(p string) bool {
 	c.lock.RLock()
@@ -107,6 +126,22 @@ func (c *Config) SetMediaCache(s int) error {
 	})
 }
 
+// MediaQuota returns the limit on the total size of all
+// media, or 0 if there is no limit.
+func (c *Config) MediaQuota() int64 {
+	c.lock.RLock()
+	res := c.cfg.MediaQuota
+	c.lock.RUnlock()
+	return res
+}
+
+// SetMediaQuota sets the media quota.
+func (c *Config) SetMediaQuota(s int64) error {
+	return c.alter(func() {
+		c.cfg.MediaQuota = s
+	})
+}
+
 func (c *Config) alter(f func()) error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -120,6 +155,9 @@ func (c *Config) alter(f func()) error {
 }
 
 func (c *Config) save() error {
+	if c.path == "" {
+		return nil
+	}
 	data, err := json.Marshal(c.cfg)
 	if err != nil {
 		return err
@@ -131,6 +169,7 @@ type configData struct {
 	PasswordHash string `json:"pass"`
 	LogSize      int    `json:"log_size"`
 	MediaCache   int    `json:"media_cache"`
+	MediaQuota   int64  `json:"media_quota"`
 }
 
 func hashPassword(p string) string {
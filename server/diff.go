@@ -0,0 +1,280 @@
+package server
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+)
+
+// DiffContext is the number of unchanged lines shown
+// around each change in a text diff.
+const DiffContext = 3
+
+// MaxDiffSize is the largest media record, in bytes, which
+// may be diffed as text.
+const MaxDiffSize = 10 << 20
+
+// maxDiffEdits limits the work done to find a minimal
+// diff. Past this many edits, the changed region is
+// reported as entirely replaced.
+const maxDiffEdits = 2000
+
+// sideBySideGap is the number of pixels between the images
+// in a side-by-side comparison.
+const sideBySideGap = 4
+
+// isTextMime checks if a MIME type is a text format which
+// can be diffed line by line.
+func isTextMime(mime string) bool {
+	mime = strings.TrimSpace(strings.Split(mime, ";")[0])
+	if strings.HasPrefix(mime, "text/") || strings.HasSuffix(mime, "+json") ||
+		strings.HasSuffix(mime, "+xml") {
+		return true
+	}
+	switch mime {
+	case "application/json", "application/xml", "application/yaml", "application/x-yaml",
+		"application/javascript", "application/toml":
+		return true
+	}
+	return false
+}
+
+type diffLine struct {
+	// Kind is ' ' for unchanged lines, '-' for deleted
+	// lines, and '+' for inserted lines.
+	Kind byte
+	Text string
+}
+
+// unifiedDiff produces a unified diff between two texts.
+// The result is empty if the texts have the same lines.
+func unifiedDiff(nameA, nameB, a, b string) string {
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	// aPos[i] and bPos[i] count the lines of a and b before
+	// lines[i].
+	aPos := make([]int, len(lines)+1)
+	bPos := make([]int, len(lines)+1)
+	for i, line := range lines {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if line.Kind != '+' {
+			aPos[i+1]++
+		}
+		if line.Kind != '-' {
+			bPos[i+1]++
+		}
+	}
+
+	var res strings.Builder
+	i := 0
+	for {
+		for i < len(lines) && lines[i].Kind == ' ' {
+			i++
+		}
+		if i == len(lines) {
+			break
+		}
+		if res.Len() == 0 {
+			fmt.Fprintf(&res, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		start := essentials.MaxInt(0, i-DiffContext)
+		end := i
+		for {
+			for end < len(lines) && lines[end].Kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(lines) && lines[next].Kind == ' ' {
+				next++
+			}
+			if next == len(lines) || next-end > 2*DiffContext {
+				break
+			}
+			end = next
+		}
+		end = essentials.MinInt(len(lines), end+DiffContext)
+		fmt.Fprintf(&res, "@@ -%s +%s @@\n", hunkRange(aPos[start], aPos[end]),
+			hunkRange(bPos[start], bPos[end]))
+		for _, line := range lines[start:end] {
+			res.WriteByte(line.Kind)
+			res.WriteString(line.Text)
+			res.WriteByte('\n')
+		}
+		i = end
+	}
+	return res.String()
+}
+
+func hunkRange(start, end int) string {
+	if end == start {
+		return fmt.Sprintf("%d,0", start)
+	} else if end == start+1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, end-start)
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes a minimal line diff using Myers'
+// algorithm.
+func diffLines(a, b []string) []diffLine {
+	var prefix, suffix []diffLine
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, diffLine{Kind: ' ', Text: a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append(suffix, diffLine{Kind: ' ', Text: a[len(a)-1]})
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	middle, ok := myersDiff(a, b)
+	if !ok {
+		middle = nil
+		for _, line := range a {
+			middle = append(middle, diffLine{Kind: '-', Text: line})
+		}
+		for _, line := range b {
+			middle = append(middle, diffLine{Kind: '+', Text: line})
+		}
+	}
+
+	res := append(prefix, middle...)
+	for i := len(suffix) - 1; i >= 0; i-- {
+		res = append(res, suffix[i])
+	}
+	return res
+}
+
+func myersDiff(a, b []string) ([]diffLine, bool) {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+
+	// trace[d] stores v[-d:d+1] from before step d.
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		if d > maxDiffEdits {
+			return nil, false
+		}
+		trace = append(trace, append([]int{}, v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return myersBacktrack(a, b, trace), true
+			}
+		}
+	}
+	panic("unreachable")
+}
+
+func myersBacktrack(a, b []string, trace [][]int) []diffLine {
+	var res []diffLine
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		prevV := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && prevV[k-1+d] < prevV[k+1+d]) {
+			prevK = k + 1
+		}
+		prevX := prevV[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			res = append(res, diffLine{Kind: ' ', Text: a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			res = append(res, diffLine{Kind: '+', Text: b[y-1]})
+		} else {
+			res = append(res, diffLine{Kind: '-', Text: a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 {
+		res = append(res, diffLine{Kind: ' ', Text: a[x-1]})
+		x--
+	}
+	for i := 0; i < len(res)/2; i++ {
+		res[i], res[len(res)-1-i] = res[len(res)-1-i], res[i]
+	}
+	return res
+}
+
+// imageDifference creates an image whose pixels are the
+// absolute differences between two images, along with the
+// number of pixels which differ.
+//
+// Images of different sizes are aligned at their top-left
+// corners, and missing pixels are treated as transparent.
+func imageDifference(img1, img2 image.Image) (*image.RGBA, int) {
+	b1, b2 := img1.Bounds(), img2.Bounds()
+	width := essentials.MaxInt(b1.Dx(), b2.Dx())
+	height := essentials.MaxInt(b1.Dy(), b2.Dy())
+	res := image.NewRGBA(image.Rect(0, 0, width, height))
+	var changed int
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c1 := pixelAt(img1, x, y)
+			c2 := pixelAt(img2, x, y)
+			if c1 != c2 {
+				changed++
+			}
+			res.SetRGBA(x, y, color.RGBA{
+				R: absDiff(c1.R, c2.R),
+				G: absDiff(c1.G, c2.G),
+				B: absDiff(c1.B, c2.B),
+				A: 0xff,
+			})
+		}
+	}
+	return res, changed
+}
+
+// imageSideBySide places two images next to each other.
+func imageSideBySide(img1, img2 image.Image) *image.RGBA {
+	b1, b2 := img1.Bounds(), img2.Bounds()
+	width := b1.Dx() + sideBySideGap + b2.Dx()
+	height := essentials.MaxInt(b1.Dy(), b2.Dy())
+	res := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(res, image.Rect(0, 0, b1.Dx(), b1.Dy()), img1, b1.Min, draw.Src)
+	draw.Draw(res, image.Rect(b1.Dx()+sideBySideGap, 0, width, b2.Dy()), img2, b2.Min, draw.Src)
+	return res
+}
+
+func pixelAt(img image.Image, x, y int) color.NRGBA {
+	bounds := img.Bounds()
+	if x >= bounds.Dx() || y >= bounds.Dy() {
+		return color.NRGBA{}
+	}
+	return color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+}
+
+func absDiff(x, y uint8) uint8 {
+	if x > y {
+		return x - y
+	}
+	return y - x
+}
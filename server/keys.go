@@ -0,0 +1,36 @@
+package server
+
+// MaxIdempotencyKeys is the number of recent idempotency
+// keys remembered for each service.
+const MaxIdempotencyKeys = 1000
+
+// keyCache remembers the IDs assigned to recent requests
+// with idempotency keys.
+type keyCache struct {
+	ids   map[string][]int
+	order []string
+}
+
+func newKeyCache() *keyCache {
+	return &keyCache{ids: map[string][]int{}}
+}
+
+// Get looks up the IDs for a key.
+func (k *keyCache) Get(key string) ([]int, bool) {
+	ids, ok := k.ids[key]
+	return ids, ok
+}
+
+// Put remembers the IDs for a key, forgetting the oldest
+// key if the cache is full.
+func (k *keyCache) Put(key string, ids []int) {
+	if _, ok := k.ids[key]; ok {
+		return
+	}
+	if len(k.order) >= MaxIdempotencyKeys {
+		delete(k.ids, k.order[0])
+		k.order = k.order[1:]
+	}
+	k.ids[key] = ids
+	k.order = append(k.order, key)
+}
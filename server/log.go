@@ -0,0 +1,787 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+)
+
+// RecentLevelWindow is the amount of time over which the
+// overview computes each service's highest log level.
+const RecentLevelWindow = time.Hour
+
+// MaxReplacedVersions is the maximum number of versions
+// kept for a media file which is added with replace set.
+// Like other media, older versions may also be deleted to
+// stay within the media cache size.
+const MaxReplacedVersions = 100
+
+// errUnknownService is wrapped by errors for operations
+// on services which do not exist.
+var errUnknownService = errors.New("unknown service")
+
+// errUnknownMedia is wrapped by errors for operations on
+// media folders which do not exist.
+var errUnknownMedia = errors.New("unknown media folder")
+
+// A notFoundError is an errUnknownService or
+// errUnknownMedia with its own message, for operations
+// whose error text predates the error codes.
+type notFoundError struct {
+	kind error
+	msg  string
+}
+
+func (n *notFoundError) Error() string {
+	return n.msg
+}
+
+func (n *notFoundError) Unwrap() error {
+	return n.kind
+}
+
+// errChecksumMismatch is wrapped by errors for uploads
+// whose contents do not match their expected hash.
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// A MediaRecord stores the metadata of a media record.
+// The contents are stored in the Log's BlobStore, keyed by
+// the record's SHA256.
+type MediaRecord struct {
+	statushub.MediaRecord
+}
+
+// Log maintains a history of statushub.LogRecords.
+type Log struct {
+	config     *Config
+	logLock    sync.RWMutex
+	curID      int
+	perService map[string][]statushub.LogRecord
+	allRecords []statushub.LogRecord
+	media      map[string]*mediaFolder
+	mediaIndex map[int]string
+	blobs      *BlobStore
+	keys       map[string]*keyCache
+	labels     map[string]statushub.Labels
+	info       map[string]json.RawMessage
+	progress   map[string]*progressTracker
+
+	serviceChans map[string]chan struct{}
+	globalChan   chan struct{}
+}
+
+// NewLog creates a log which depends on a configuration
+// to get the maximum log size.
+// Media contents are stored in blobs.
+func NewLog(cfg *Config, blobs *BlobStore) *Log {
+	return &Log{
+		config:       cfg,
+		blobs:        blobs,
+		perService:   map[string][]statushub.LogRecord{},
+		media:        map[string]*mediaFolder{},
+		mediaIndex:   map[int]string{},
+		keys:         map[string]*keyCache{},
+		labels:       map[string]statushub.Labels{},
+		info:         map[string]json.RawMessage{},
+		progress:     map[string]*progressTracker{},
+		serviceChans: map[string]chan struct{}{},
+	}
+}
+
+// Add adds records to the log.
+//
+// If key is non-empty, it is used as an idempotency key.
+// If a recent call for the same service used the same key,
+// the IDs from that call are returned and nothing is
+// added.
+func (l *Log) Add(service, key string, entries []statushub.Entry) ([]int, error) {
+	ls := l.config.LogSize()
+	ids := []int{}
+
+	// Technically, there is a possible scenario when
+	// LogSizeUpdated() is called while we are right here,
+	// resulting in a log which is larger than the current
+	// log size.
+	// However, this is not that big an issue and avoids
+	// locking the configuration (which might be I/O bound)
+	// while holding the log lock.
+
+	l.logLock.Lock()
+	if key != "" {
+		if cache, ok := l.keys[service]; ok {
+			if oldIDs, ok := cache.Get(key); ok {
+				l.logLock.Unlock()
+				return append([]int{}, oldIDs...), nil
+			}
+		}
+	}
+	for _, entry := range entries {
+		record := statushub.LogRecord{
+			Service:  service,
+			Message:  entry.Message,
+			Level:    entry.Level,
+			Labels:   entry.Labels,
+			MediaIDs: entry.MediaIDs,
+			Time:     time.Now().Unix(),
+			ID:       l.curID,
+		}
+		l.curID++
+		l.allRecords = append(l.allRecords, record)
+		l.perService[service] = append(l.perService[service], record)
+		ids = append(ids, record.ID)
+	}
+	l.allRecords = trimLog(l.allRecords, ls)
+	l.perService[service] = trimLog(l.perService[service], ls)
+	if key != "" {
+		if _, ok := l.keys[service]; !ok {
+			l.keys[service] = newKeyCache()
+		}
+		l.keys[service].Put(key, append([]int{}, ids...))
+	}
+	l.wakeListeners(service)
+	l.logLock.Unlock()
+	return ids, nil
+}
+
+// A MediaUpload describes a media record to add with
+// UploadMedia.
+type MediaUpload struct {
+	Folder   string
+	Filename string
+	Mime     string
+
+	// Replace hides older versions of the file from the
+	// media log.
+	// They remain available as versions, up to
+	// MaxReplacedVersions of them.
+	Replace bool
+
+	// Service, if non-empty, is a service to which a log
+	// record linking to the media is added.
+	Service string
+
+	// SHA256, if non-empty, is the expected hex-encoded
+	// SHA-256 hash of the contents.
+	SHA256 string
+}
+
+// AddMedia adds a media record with the contents of r.
+func (l *Log) AddMedia(folder, filename, mime string, r io.Reader, replace bool) (int, error) {
+	return l.UploadMedia(&MediaUpload{
+		Folder:   folder,
+		Filename: filename,
+		Mime:     mime,
+		Replace:  replace,
+	}, r)
+}
+
+// UploadMedia adds a media record with the contents of r.
+//
+// It fails without adding the record if the contents do
+// not match the upload's SHA256.
+// If the upload has a service, a log record linking to
+// the media is also added, with a message created by
+// statushub.MediaMessage.
+func (l *Log) UploadMedia(upload *MediaUpload, r io.Reader) (int, error) {
+	cacheSize := l.config.MediaCache()
+	quota := l.config.MediaQuota()
+
+	// See comment in Add().
+
+	hash, size, err := l.blobs.Put(r)
+	if err != nil {
+		return 0, err
+	}
+	if upload.SHA256 != "" && !strings.EqualFold(upload.SHA256, hash) {
+		l.blobs.Release(hash)
+		return 0, fmt.Errorf("%w: expected SHA-256 %s but got %s", errChecksumMismatch,
+			strings.ToLower(upload.SHA256), hash)
+	}
+	width, height := imageSize(l.blobs, hash, upload.Mime)
+
+	l.logLock.Lock()
+	record := MediaRecord{
+		MediaRecord: statushub.MediaRecord{
+			Folder:   upload.Folder,
+			Filename: upload.Filename,
+			Mime:     upload.Mime,
+			Time:     time.Now().Unix(),
+			ID:       l.curID,
+			Size:     size,
+			Width:    width,
+			Height:   height,
+			SHA256:   hash,
+		},
+	}
+	l.curID++
+	if mediaFolder, ok := l.media[upload.Folder]; ok {
+		record.Version = mediaFolder.NextVersion(upload.Filename)
+	} else {
+		record.Version = 1
+	}
+	if upload.Replace {
+		if folder, ok := l.media[upload.Folder]; ok {
+			folder.Replace(upload.Filename)
+		}
+	}
+	l.addMedia(record)
+	if upload.Replace {
+		l.trimVersions(upload.Folder, upload.Filename, MaxReplacedVersions)
+	}
+	l.trimMedia(upload.Folder, cacheSize)
+	l.enforceMediaQuota(quota, record.ID)
+	l.logLock.Unlock()
+
+	if upload.Service != "" {
+		entry := statushub.Entry{
+			Message:  statushub.MediaMessage(upload.Folder, upload.Filename),
+			MediaIDs: []int{record.ID},
+		}
+		if _, err := l.Add(upload.Service, "", []statushub.Entry{entry}); err != nil {
+			return 0, essentials.AddCtx("link media", err)
+		}
+	}
+	return record.ID, nil
+}
+
+// DeleteService deletes a service.
+// It fails if the service does not exist.
+func (l *Log) DeleteService(name string) error {
+	l.logLock.Lock()
+	defer l.logLock.Unlock()
+	if _, ok := l.perService[name]; !ok {
+		return &notFoundError{kind: errUnknownService, msg: "no such service: " + name}
+	}
+	delete(l.perService, name)
+	delete(l.keys, name)
+	delete(l.labels, name)
+	delete(l.info, name)
+	delete(l.progress, name)
+	newLen := 0
+	for _, x := range l.allRecords {
+		if x.Service != name {
+			l.allRecords[newLen] = x
+			newLen++
+		}
+	}
+	l.allRecords = l.allRecords[:newLen]
+	l.wakeListeners(name)
+	return nil
+}
+
+// DeleteNamespace deletes every service in a namespace,
+// as in statushub.InNamespace, and returns the deleted
+// service names in sorted order.
+//
+// If dryRun is true, the services are returned but not
+// deleted.
+// It fails if the namespace is empty or if it contains no
+// services.
+func (l *Log) DeleteNamespace(namespace string, dryRun bool) ([]string, error) {
+	if strings.TrimSuffix(namespace, statushub.NamespaceSeparator) == "" {
+		return nil, errors.New("refusing to delete the empty namespace")
+	}
+	l.logLock.Lock()
+	defer l.logLock.Unlock()
+	var names []string
+	for name := range l.perService {
+		if statushub.InNamespace(name, namespace) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: no services in namespace %s", errUnknownService, namespace)
+	}
+	sort.Strings(names)
+	if dryRun {
+		return names, nil
+	}
+	newLen := 0
+	for _, x := range l.allRecords {
+		if !statushub.InNamespace(x.Service, namespace) {
+			l.allRecords[newLen] = x
+			newLen++
+		}
+	}
+	l.allRecords = l.allRecords[:newLen]
+	for _, name := range names {
+		delete(l.perService, name)
+		delete(l.keys, name)
+		delete(l.labels, name)
+		delete(l.info, name)
+		delete(l.progress, name)
+		l.wakeListeners(name)
+	}
+	return names, nil
+}
+
+// DeleteMedia deletes a media entry.
+// It fails if the folder does not exist.
+func (l *Log) DeleteMedia(folder string) error {
+	l.logLock.Lock()
+	defer l.logLock.Unlock()
+	records, ok := l.media[folder]
+	if !ok {
+		return &notFoundError{kind: errUnknownMedia, msg: "no such media folder: " + folder}
+	}
+	for _, record := range records.Records() {
+		l.releaseMedia(record)
+	}
+	delete(l.media, folder)
+	return nil
+}
+
+// Overview returns the most recent log record per
+// service, sorted from most to least recent.
+//
+// Each record's MaxLevel is the highest level among the
+// service's records from the last RecentLevelWindow.
+func (l *Log) Overview() []statushub.LogRecord {
+	minTime := time.Now().Add(-RecentLevelWindow).Unix()
+	l.logLock.RLock()
+	var entries []statushub.LogRecord
+	for _, v := range l.perService {
+		entry := l.withMedia(l.withServiceLabels(v[len(v)-1]))
+		entry.Info = l.info[entry.Service]
+		entry.Progress = l.serviceProgress(entry.Service)
+		for i := len(v) - 1; i >= 0 && v[i].Time >= minTime; i-- {
+			if v[i].Level.Effective() > entry.MaxLevel {
+				entry.MaxLevel = v[i].Level.Effective()
+			}
+		}
+		entries = append(entries, entry)
+	}
+	l.logLock.RUnlock()
+	essentials.VoodooSort(entries, func(i, j int) bool {
+		return entries[i].ID > entries[j].ID
+	})
+	return entries
+}
+
+// MediaOverview returns the most recent media record per
+// folder, sorted from most to least recent.
+func (l *Log) MediaOverview() []statushub.MediaRecord {
+	l.logLock.RLock()
+	var entries []statushub.MediaRecord
+	for _, v := range l.media {
+		entries = append(entries, v.Newest().MediaRecord)
+	}
+	l.logLock.RUnlock()
+	essentials.VoodooSort(entries, func(i, j int) bool {
+		return entries[i].ID > entries[j].ID
+	})
+	return entries
+}
+
+// FullLog returns all of the log records, sorted from
+// most to least recent.
+func (l *Log) FullLog() []statushub.LogRecord {
+	l.logLock.RLock()
+	res := make([]statushub.LogRecord, len(l.allRecords))
+	for i, record := range l.allRecords {
+		res[i] = l.withMedia(l.withServiceLabels(record))
+	}
+	l.logLock.RUnlock()
+	essentials.Reverse(res)
+	return res
+}
+
+// ServiceLog returns the log records for a particular
+// service, sorted from most to least recent.
+// It fails if there are no log records for the service.
+func (l *Log) ServiceLog(name string) ([]statushub.LogRecord, error) {
+	l.logLock.RLock()
+	defer l.logLock.RUnlock()
+	entries, ok := l.perService[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownService, name)
+	}
+	res := make([]statushub.LogRecord, len(entries))
+	for i, record := range entries {
+		res[len(entries)-(i+1)] = l.withMedia(l.withServiceLabels(record))
+	}
+	return res, nil
+}
+
+// MediaLog returns the media records for a folder, sorted
+// by most to least recent.
+// Replaced records are omitted.
+// It fails if there are no media records for the folder.
+func (l *Log) MediaLog(folder string) ([]statushub.MediaRecord, error) {
+	l.logLock.RLock()
+	defer l.logLock.RUnlock()
+	records, ok := l.media[folder]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownMedia, folder)
+	}
+	entries := records.Records()
+	res := make([]statushub.MediaRecord, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Replaced {
+			res = append(res, entries[i].MediaRecord)
+		}
+	}
+	return res, nil
+}
+
+// MediaVersions returns the versions of a file in a media
+// folder, sorted by most to least recent.
+// It fails if there are no such versions.
+func (l *Log) MediaVersions(folder, filename string) ([]statushub.MediaRecord, error) {
+	l.logLock.RLock()
+	defer l.logLock.RUnlock()
+	versions, err := l.mediaVersions(folder, filename)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]statushub.MediaRecord, len(versions))
+	for i, x := range versions {
+		res[len(versions)-(i+1)] = x.MediaRecord
+	}
+	return res, nil
+}
+
+// MediaVersion looks up a version of a file in a media
+// folder.
+// If version is 0, the latest version is returned.
+func (l *Log) MediaVersion(folder, filename string, version int) (*statushub.MediaRecord, error) {
+	l.logLock.RLock()
+	defer l.logLock.RUnlock()
+	versions, err := l.mediaVersions(folder, filename)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if version == 0 || versions[i].Version == version {
+			res := versions[i].MediaRecord
+			return &res, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no version %d of %s in %s", errUnknownMedia, version, filename,
+		folder)
+}
+
+// MediaRecord looks up the media record by ID.
+func (l *Log) MediaRecord(id int) *MediaRecord {
+	l.logLock.RLock()
+	defer l.logLock.RUnlock()
+	if record := l.findMedia(id); record != nil {
+		res := *record
+		return &res
+	}
+	return nil
+}
+
+// OpenMedia looks up a media record by ID and opens its
+// contents.
+// The caller must close the contents.
+func (l *Log) OpenMedia(id int) (*MediaRecord, io.ReadSeekCloser, error) {
+	l.logLock.RLock()
+	defer l.logLock.RUnlock()
+	record := l.findMedia(id)
+	if record == nil {
+		return nil, nil, fmt.Errorf("%w: no record with ID %d", errUnknownMedia, id)
+	}
+	contents, err := l.blobs.Open(record.SHA256)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := *record
+	return &res, contents, nil
+}
+
+// SetServiceLabels replaces the labels of a service.
+//
+// The labels are included in the labels of every record
+// from the service.
+// The service does not have to exist yet.
+func (l *Log) SetServiceLabels(service string, labels statushub.Labels) {
+	l.logLock.Lock()
+	defer l.logLock.Unlock()
+	if len(labels) == 0 {
+		delete(l.labels, service)
+	} else {
+		l.labels[service] = labels
+	}
+}
+
+// ServiceLabels returns the labels of a service.
+func (l *Log) ServiceLabels(service string) statushub.Labels {
+	l.logLock.RLock()
+	defer l.logLock.RUnlock()
+	res := statushub.Labels{}
+	for k, v := range l.labels[service] {
+		res[k] = v
+	}
+	return res
+}
+
+// SetServiceInfo replaces the JSON document attached to a
+// service.
+//
+// An empty or null info removes the service's info.
+// The service does not have to exist yet.
+func (l *Log) SetServiceInfo(service string, info json.RawMessage) {
+	l.logLock.Lock()
+	defer l.logLock.Unlock()
+	if len(info) == 0 || string(info) == "null" {
+		delete(l.info, service)
+	} else {
+		l.info[service] = info
+	}
+}
+
+// ServiceInfo returns the JSON document attached to a
+// service, or nil if there is none.
+func (l *Log) ServiceInfo(service string) json.RawMessage {
+	l.logLock.RLock()
+	defer l.logLock.RUnlock()
+	return l.info[service]
+}
+
+// SetProgress records the progress of a service.
+//
+// The service does not have to exist yet.
+func (l *Log) SetProgress(service string, done, total float64) error {
+	if !(total > 0) || !(done >= 0) || math.IsInf(total, 0) || math.IsInf(done, 0) {
+		return errors.New("invalid progress")
+	}
+	l.logLock.Lock()
+	defer l.logLock.Unlock()
+	tracker, ok := l.progress[service]
+	if !ok {
+		tracker = &progressTracker{}
+		l.progress[service] = tracker
+	}
+	tracker.Update(done, total, time.Now())
+	l.wakeListeners(service)
+	return nil
+}
+
+// Progress returns the latest progress of a service, or
+// nil if the service has not reported progress.
+func (l *Log) Progress(service string) *statushub.Progress {
+	l.logLock.RLock()
+	defer l.logLock.RUnlock()
+	return l.serviceProgress(service)
+}
+
+// LogSizeUpdated directs the log to delete log records as
+// needed to accommodate the new log size.
+func (l *Log) LogSizeUpdated() {
+	ls := l.config.LogSize()
+	l.logLock.Lock()
+	l.allRecords = trimLog(l.allRecords, ls)
+	for k, v := range l.perService {
+		l.perService[k] = trimLog(v, ls)
+	}
+	l.logLock.Unlock()
+}
+
+// MediaCacheUpdated directs the log to delete media
+// records as needed to accommodate the new cache size and
+// media quota.
+func (l *Log) MediaCacheUpdated() {
+	cacheSize := l.config.MediaCache()
+	quota := l.config.MediaQuota()
+	l.logLock.Lock()
+	for name := range l.media {
+		l.trimMedia(name, cacheSize)
+	}
+	l.enforceMediaQuota(quota, -1)
+	l.logLock.Unlock()
+}
+
+// Wait creates a channel which is closed when any log
+// entry is added or deleted.
+// If the cancel chan is closed, the returned channel
+// is closed early.
+func (l *Log) Wait() <-chan struct{} {
+	l.logLock.Lock()
+	defer l.logLock.Unlock()
+	if l.globalChan == nil {
+		l.globalChan = make(chan struct{})
+	}
+	return l.globalChan
+}
+
+// WaitService creates a channel which is closed when a
+// log entry is added to the service, or when the service
+// is deleted.
+func (l *Log) WaitService(name string) <-chan struct{} {
+	l.logLock.Lock()
+	defer l.logLock.Unlock()
+	ch, ok := l.serviceChans[name]
+	if !ok {
+		ch = make(chan struct{})
+		l.serviceChans[name] = ch
+	}
+	return ch
+}
+
+// serviceProgress is like Progress, but it assumes the log
+// is already locked.
+func (l *Log) serviceProgress(service string) *statushub.Progress {
+	if tracker, ok := l.progress[service]; ok {
+		return tracker.Progress()
+	}
+	return nil
+}
+
+// withServiceLabels merges the labels of a record's
+// service into the record's labels.
+//
+// You should only call this while holding the log lock.
+func (l *Log) withServiceLabels(record statushub.LogRecord) statushub.LogRecord {
+	record.Labels = l.labels[record.Service].Merge(record.Labels)
+	return record
+}
+
+// withMedia looks up the media records attached to a
+// record.
+//
+// You should only call this while holding the log lock.
+func (l *Log) withMedia(record statushub.LogRecord) statushub.LogRecord {
+	record.Media = nil
+	for _, id := range record.MediaIDs {
+		if media := l.findMedia(id); media != nil {
+			record.Media = append(record.Media, media.MediaRecord)
+		}
+	}
+	return record
+}
+
+// wakeListeners wakes all the listeners for the service,
+// as well as all global listeners.
+//
+// You should only call this while holding the log lock.
+func (l *Log) wakeListeners(service string) {
+	if ch, ok := l.serviceChans[service]; ok {
+		close(ch)
+		delete(l.serviceChans, service)
+	}
+	if l.globalChan != nil {
+		close(l.globalChan)
+		l.globalChan = nil
+	}
+}
+
+func trimLog(log []statushub.LogRecord, maxSize int) []statushub.LogRecord {
+	if maxSize == 0 {
+		return log
+	}
+	if len(log) <= maxSize {
+		return log
+	}
+	overflow := len(log) - maxSize
+	copy(log[:], log[overflow:])
+	return log[:maxSize]
+}
+
+// addMedia adds a record to its folder, creating the
+// folder if necessary.
+func (l *Log) addMedia(record MediaRecord) {
+	folder, ok := l.media[record.Folder]
+	if !ok {
+		folder = &mediaFolder{}
+		l.media[record.Folder] = folder
+	}
+	folder.Add(record)
+	l.mediaIndex[record.ID] = record.Folder
+}
+
+// findMedia finds a media record by ID, or returns nil.
+func (l *Log) findMedia(id int) *MediaRecord {
+	name, ok := l.mediaIndex[id]
+	if !ok {
+		return nil
+	}
+	return l.media[name].Find(id)
+}
+
+func (l *Log) mediaVersions(folder, filename string) ([]MediaRecord, error) {
+	records, ok := l.media[folder]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownMedia, folder)
+	}
+	versions := records.Versions(filename)
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: no file %s in %s", errUnknownMedia, filename, folder)
+	}
+	return versions, nil
+}
+
+// removeOldestMedia deletes the oldest record in a folder,
+// deleting the folder if it becomes empty.
+func (l *Log) removeOldestMedia(name string) {
+	folder := l.media[name]
+	l.releaseMedia(folder.RemoveOldest())
+	if folder.Len() == 0 {
+		delete(l.media, name)
+	}
+}
+
+// releaseMedia cleans up after a record which has been
+// removed from its folder.
+func (l *Log) releaseMedia(record MediaRecord) {
+	l.blobs.Release(record.SHA256)
+	delete(l.mediaIndex, record.ID)
+}
+
+func (l *Log) trimMedia(name string, cacheSize int) {
+	if cacheSize == 0 {
+		return
+	}
+	folder := l.media[name]
+	for folder.Len() > 1 && folder.Size() > int64(cacheSize) {
+		l.removeOldestMedia(name)
+	}
+}
+
+// trimVersions deletes the oldest versions of a file
+// until at most max versions remain.
+func (l *Log) trimVersions(name, filename string, max int) {
+	folder, ok := l.media[name]
+	if !ok {
+		return
+	}
+	for _, record := range folder.TrimVersions(filename, max) {
+		l.releaseMedia(record)
+	}
+	if folder.Len() == 0 {
+		delete(l.media, name)
+	}
+}
+
+// enforceMediaQuota deletes the oldest media records until
+// the blob store fits within the quota.
+// The record with ID keepID is never deleted.
+func (l *Log) enforceMediaQuota(quota int64, keepID int) {
+	if quota == 0 {
+		return
+	}
+	for l.blobs.TotalSize() > quota {
+		oldestFolder := ""
+		oldestID := -1
+		for name, folder := range l.media {
+			id := folder.Oldest().ID
+			if id != keepID && (oldestID == -1 || id < oldestID) {
+				oldestFolder = name
+				oldestID = id
+			}
+		}
+		if oldestID == -1 {
+			return
+		}
+		l.removeOldestMedia(oldestFolder)
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import "sort"
+
+// A mediaFolder stores the records of a media folder,
+// sorted by ID, along with their total size.
+//
+// Deleting the oldest record takes amortized constant
+// time, and records can be found by ID in logarithmic
+// time.
+type mediaFolder struct {
+	// records[start:] are the records in the folder.
+	records []MediaRecord
+	start   int
+
+	size int64
+
+	// versions maps each filename to its latest version.
+	versions map[string]int
+}
+
+// Records returns the records in the folder, from oldest
+// to newest.
+// The result should not be modified.
+func (m *mediaFolder) Records() []MediaRecord {
+	return m.records[m.start:]
+}
+
+// Len returns the number of records in the folder.
+func (m *mediaFolder) Len() int {
+	return len(m.records) - m.start
+}
+
+// Size returns the total size of the records in the
+// folder.
+func (m *mediaFolder) Size() int64 {
+	return m.size
+}
+
+// Oldest returns the oldest record in the folder.
+// The folder must not be empty.
+func (m *mediaFolder) Oldest() *MediaRecord {
+	return &m.records[m.start]
+}
+
+// Newest returns the newest record in the folder.
+// The folder must not be empty.
+func (m *mediaFolder) Newest() *MediaRecord {
+	return &m.records[len(m.records)-1]
+}
+
+// Find finds the record with the given ID, or returns nil.
+func (m *mediaFolder) Find(id int) *MediaRecord {
+	records := m.Records()
+	idx := sort.Search(len(records), func(i int) bool {
+		return records[i].ID >= id
+	})
+	if idx < len(records) && records[idx].ID == id {
+		return &records[idx]
+	}
+	return nil
+}
+
+// Add adds a record, which must be newer than every
+// record in the folder.
+//
+// If the record has no version, it is assigned the next
+// version of its filename.
+func (m *mediaFolder) Add(record MediaRecord) {
+	if record.Version == 0 {
+		record.Version = m.NextVersion(record.Filename)
+	}
+	if m.versions == nil {
+		m.versions = map[string]int{}
+	}
+	if record.Version > m.versions[record.Filename] {
+		m.versions[record.Filename] = record.Version
+	}
+	m.records = append(m.records, record)
+	m.size += record.Size
+}
+
+// NextVersion returns the version number for the next
+// record with the given filename.
+//
+// Version numbers keep increasing even after old versions
+// are removed from the folder.
+func (m *mediaFolder) NextVersion(filename string) int {
+	return m.versions[filename] + 1
+}
+
+// Versions returns the records with the given filename,
+// from oldest to newest.
+func (m *mediaFolder) Versions(filename string) []MediaRecord {
+	var res []MediaRecord
+	for _, record := range m.Records() {
+		if record.Filename == filename {
+			res = append(res, record)
+		}
+	}
+	return res
+}
+
+// RemoveOldest removes and returns the oldest record.
+// The folder must not be empty.
+func (m *mediaFolder) RemoveOldest() MediaRecord {
+	res := m.records[m.start]
+	m.records[m.start] = MediaRecord{}
+	m.start++
+	m.size -= res.Size
+
+	// Compact once at least half of the slice is unused,
+	// so that removals take amortized constant time.
+	if m.start*2 >= len(m.records) {
+		m.records = append([]MediaRecord{}, m.records[m.start:]...)
+		m.start = 0
+	}
+	return res
+}
+
+// Replace marks every record with the given filename as
+// replaced.
+func (m *mediaFolder) Replace(filename string) {
+	for i := m.start; i < len(m.records); i++ {
+		if m.records[i].Filename == filename {
+			m.records[i].Replaced = true
+		}
+	}
+}
+
+// TrimVersions removes and returns the oldest records with
+// the given filename, until at most max remain.
+func (m *mediaFolder) TrimVersions(filename string, max int) []MediaRecord {
+	numRemove := -max
+	for _, record := range m.Records() {
+		if record.Filename == filename {
+			numRemove++
+		}
+	}
+	if numRemove <= 0 {
+		return nil
+	}
+	var removed []MediaRecord
+	kept := m.records[:m.start]
+	for _, record := range m.records[m.start:] {
+		if record.Filename == filename && len(removed) < numRemove {
+			removed = append(removed, record)
+			m.size -= record.Size
+		} else {
+			kept = append(kept, record)
+		}
+	}
+	for i := len(kept); i < len(m.records); i++ {
+		m.records[i] = MediaRecord{}
+	}
+	m.records = kept
+	return removed
+}
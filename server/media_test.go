@@ -0,0 +1,333 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+)
+
+// TestMediaFolderLinearScan checks a mediaFolder against a
+// plain list of records after interleaved adds, replaces,
+// and trims.
+func TestMediaFolderLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1337))
+	filenames := []string{"a.png", "b.png", "c.txt", "d.svg"}
+
+	folder := &mediaFolder{}
+	var expected []MediaRecord
+	latest := map[string]int{}
+	curID := 0
+
+	add := func(filename string) {
+		curID += 1 + rng.Intn(3)
+		latest[filename]++
+		record := MediaRecord{MediaRecord: statushub.MediaRecord{
+			Folder:   "folder",
+			Filename: filename,
+			ID:       curID,
+			Size:     int64(rng.Intn(100)),
+		}}
+		folder.Add(record)
+		record.Version = latest[filename]
+		expected = append(expected, record)
+	}
+
+	for i := 0; i < 5000; i++ {
+		filename := filenames[rng.Intn(len(filenames))]
+		switch rng.Intn(4) {
+		case 0, 1:
+			add(filename)
+		case 2:
+			folder.Replace(filename)
+			for j := range expected {
+				if expected[j].Filename == filename {
+					expected[j].Replaced = true
+				}
+			}
+			add(filename)
+			max := 1 + rng.Intn(4)
+			removed := folder.TrimVersions(filename, max)
+			var kept, expectedRemoved []MediaRecord
+			numVersions := 0
+			for _, record := range expected {
+				if record.Filename == filename {
+					numVersions++
+				}
+			}
+			for _, record := range expected {
+				if record.Filename == filename && numVersions > max {
+					expectedRemoved = append(expectedRemoved, record)
+					numVersions--
+				} else {
+					kept = append(kept, record)
+				}
+			}
+			expected = kept
+			if !reflect.DeepEqual(removed, expectedRemoved) {
+				t.Fatalf("step %d: TrimVersions removed %v but expected %v", i, removed,
+					expectedRemoved)
+			}
+		case 3:
+			for n := rng.Intn(5); n > 0 && folder.Len() > 0; n-- {
+				removed := folder.RemoveOldest()
+				if !reflect.DeepEqual(removed, expected[0]) {
+					t.Fatalf("step %d: RemoveOldest returned %v but expected %v", i, removed,
+						expected[0])
+				}
+				expected = expected[1:]
+			}
+		}
+		checkMediaFolder(t, i, folder, expected, filenames, curID)
+	}
+}
+
+func checkMediaFolder(t *testing.T, step int, folder *mediaFolder, expected []MediaRecord,
+	filenames []string, maxID int) {
+	if folder.Len() != len(expected) {
+		t.Fatalf("step %d: expected %d records but got %d", step, len(expected), folder.Len())
+	}
+	if len(expected) == 0 {
+		if folder.Size() != 0 {
+			t.Fatalf("step %d: empty folder has size %d", step, folder.Size())
+		}
+		return
+	}
+	if !reflect.DeepEqual(folder.Records(), expected) {
+		t.Fatalf("step %d: records do not match", step)
+	}
+	var size int64
+	for _, record := range expected {
+		size += record.Size
+	}
+	if folder.Size() != size {
+		t.Fatalf("step %d: expected size %d but got %d", step, size, folder.Size())
+	}
+	if *folder.Oldest() != expected[0] || *folder.Newest() != expected[len(expected)-1] {
+		t.Fatalf("step %d: unexpected oldest or newest record", step)
+	}
+	for id := expected[0].ID - 1; id <= maxID+1; id++ {
+		var linear *MediaRecord
+		for i := range expected {
+			if expected[i].ID == id {
+				linear = &expected[i]
+			}
+		}
+		actual := folder.Find(id)
+		if (actual == nil) != (linear == nil) || (actual != nil && *actual != *linear) {
+			t.Fatalf("step %d: Find(%d) returned %v but expected %v", step, id, actual, linear)
+		}
+	}
+	for _, filename := range filenames {
+		var versions []MediaRecord
+		for _, record := range expected {
+			if record.Filename == filename {
+				versions = append(versions, record)
+			}
+		}
+		if actual := folder.Versions(filename); !reflect.DeepEqual(actual, versions) {
+			t.Fatalf("step %d: Versions(%q) returned %v but expected %v", step, filename,
+				actual, versions)
+		}
+		if len(versions) > 0 && folder.NextVersion(filename) <= versions[len(versions)-1].Version {
+			t.Fatalf("step %d: NextVersion(%q) reuses a version", step, filename)
+		}
+	}
+}
+
+var benchmarkMediaSizes = []int{10000, 100000}
+
+// benchmarkNumFolders is the number of folders that the
+// records are spread across in BenchmarkMediaRecord.
+const benchmarkNumFolders = 100
+
+func BenchmarkMediaRecord(b *testing.B) {
+	for _, n := range benchmarkMediaSizes {
+		b.Run(fmt.Sprintf("linear/%d", n), func(b *testing.B) {
+			media := map[string][]MediaRecord{}
+			for i := 1; i <= n; i++ {
+				record := benchmarkMediaRecord(i)
+				record.Folder = benchmarkFolderName(i)
+				media[record.Folder] = append(media[record.Folder], record)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if linearMediaRecord(media, i%n+1) == nil {
+					b.Fatal("record not found")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			log := newBenchmarkLog()
+			for i := 1; i <= n; i++ {
+				record := benchmarkMediaRecord(i)
+				record.Folder = benchmarkFolderName(i)
+				log.addMedia(record)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if log.MediaRecord(i%n+1) == nil {
+					b.Fatal("record not found")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMediaFolderFind(b *testing.B) {
+	for _, n := range benchmarkMediaSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			folder := benchmarkMediaFolder(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if folder.Find(i%n+1) == nil {
+					b.Fatal("record not found")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkMediaTrim adds a record to a full folder and
+// trims the folder back to its cache size.
+func BenchmarkMediaTrim(b *testing.B) {
+	for _, n := range benchmarkMediaSizes {
+		b.Run(fmt.Sprintf("linear/%d", n), func(b *testing.B) {
+			records := benchmarkMediaRecords(n)
+			cacheSize := int64(n) * benchmarkRecordSize
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				records = append(records, benchmarkMediaRecord(n+i+1))
+				records = linearTrimMedia(records, cacheSize)
+			}
+		})
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			log := benchmarkMediaLog(n)
+			cacheSize := n * benchmarkRecordSize
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				log.addMedia(benchmarkMediaRecord(n + i + 1))
+				log.trimMedia("folder", cacheSize)
+			}
+		})
+	}
+}
+
+// BenchmarkMediaTrimBulk trims a tenth of the records from
+// a folder at once, as when the cache size is lowered.
+func BenchmarkMediaTrimBulk(b *testing.B) {
+	for _, n := range benchmarkMediaSizes {
+		cacheSize := int64(n-n/10) * benchmarkRecordSize
+		b.Run(fmt.Sprintf("linear/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				records := benchmarkMediaRecords(n)
+				b.StartTimer()
+				linearTrimMedia(records, cacheSize)
+			}
+		})
+		b.Run(fmt.Sprintf("indexed/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				log := benchmarkMediaLog(n)
+				b.StartTimer()
+				log.trimMedia("folder", int(cacheSize))
+			}
+		})
+	}
+}
+
+func BenchmarkMediaLog(b *testing.B) {
+	for _, n := range benchmarkMediaSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			log := benchmarkMediaLog(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := log.MediaLog("folder"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// linearMediaRecord is the lookup used before folders were
+// indexed, which scans every record.
+func linearMediaRecord(media map[string][]MediaRecord, id int) *MediaRecord {
+	for _, records := range media {
+		for _, record := range records {
+			if record.ID == id {
+				return &record
+			}
+		}
+	}
+	return nil
+}
+
+// linearTrimMedia is the trimming used before folders were
+// indexed, which recomputes the folder size and shifts the
+// records for every removal.
+func linearTrimMedia(log []MediaRecord, cacheSize int64) []MediaRecord {
+	for len(log) > 1 {
+		var totalSize int64
+		for _, item := range log {
+			totalSize += item.Size
+		}
+		if totalSize > cacheSize {
+			essentials.OrderedDelete(&log, 0)
+		} else {
+			break
+		}
+	}
+	return log
+}
+
+const benchmarkRecordSize = 100
+
+func benchmarkMediaFolder(n int) *mediaFolder {
+	folder := &mediaFolder{}
+	for i := 1; i <= n; i++ {
+		folder.Add(benchmarkMediaRecord(i))
+	}
+	return folder
+}
+
+func benchmarkMediaRecords(n int) []MediaRecord {
+	records := make([]MediaRecord, n)
+	for i := range records {
+		records[i] = benchmarkMediaRecord(i + 1)
+	}
+	return records
+}
+
+func benchmarkMediaLog(n int) *Log {
+	log := newBenchmarkLog()
+	for i := 1; i <= n; i++ {
+		log.addMedia(benchmarkMediaRecord(i))
+	}
+	return log
+}
+
+func newBenchmarkLog() *Log {
+	blobs, err := NewBlobStore("")
+	if err != nil {
+		panic(err)
+	}
+	return NewLog(NewConfig("password"), blobs)
+}
+
+func benchmarkFolderName(id int) string {
+	return fmt.Sprintf("folder%d", id%benchmarkNumFolders)
+}
+
+func benchmarkMediaRecord(id int) MediaRecord {
+	return MediaRecord{MediaRecord: statushub.MediaRecord{
+		Folder:   "folder",
+		Filename: fmt.Sprintf("sample%d.png", id%100),
+		ID:       id,
+		Size:     benchmarkRecordSize,
+	}}
+}
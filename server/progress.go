@@ -0,0 +1,64 @@
+package server
+
+import (
+	"time"
+
+	"github.com/unixpickle/statushub"
+)
+
+// ProgressWindow is the amount of time over which a
+// service's progress rate is estimated.
+const ProgressWindow = time.Minute * 10
+
+// MaxProgressSamples is the maximum number of updates per
+// service used to estimate progress rates.
+const MaxProgressSamples = 100
+
+type progressSample struct {
+	Done float64
+	Time time.Time
+}
+
+// A progressTracker estimates the rate and ETA of a
+// service's progress from its recent updates.
+type progressTracker struct {
+	total   float64
+	samples []progressSample
+}
+
+// Update records a new progress update.
+//
+// If the progress went backwards (e.g. because a job was
+// restarted), previous updates are forgotten.
+func (p *progressTracker) Update(done, total float64, now time.Time) {
+	if total != p.total || (len(p.samples) > 0 && done < p.samples[len(p.samples)-1].Done) {
+		p.samples = nil
+	}
+	p.total = total
+	p.samples = append(p.samples, progressSample{Done: done, Time: now})
+
+	minTime := now.Add(-ProgressWindow)
+	numOld := 0
+	for numOld < len(p.samples)-1 && (p.samples[numOld].Time.Before(minTime) ||
+		len(p.samples)-numOld > MaxProgressSamples) {
+		numOld++
+	}
+	p.samples = append(p.samples[:0], p.samples[numOld:]...)
+}
+
+// Progress computes the current progress estimate.
+func (p *progressTracker) Progress() *statushub.Progress {
+	first, last := p.samples[0], p.samples[len(p.samples)-1]
+	res := &statushub.Progress{
+		Done:  last.Done,
+		Total: p.total,
+		Time:  last.Time.Unix(),
+	}
+	if elapsed := last.Time.Sub(first.Time).Seconds(); elapsed > 0 && last.Done > first.Done {
+		res.Rate = (last.Done - first.Done) / elapsed
+		if last.Done < p.total {
+			res.ETA = (p.total - last.Done) / res.Rate
+		}
+	}
+	return res
+}
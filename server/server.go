@@ -0,0 +1,158 @@
+// Package server implements the StatusHub back-end.
+//
+// It is used by the sh-server command, but it can also be
+// embedded in other programs, such as tests.
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/unixpickle/ratelimit"
+)
+
+const (
+	RateLimitDuration = time.Minute * 30
+	RateLimitAttempts = 200
+)
+
+// A Server serves the StatusHub web UI and API.
+type Server struct {
+	Config     *Config
+	Log        *Log
+	Uploads    *UploadManager
+	Thumbnails *ThumbnailCache
+	Sessions   *SessionManager
+	LoginLimit *ratelimit.TimeSliceLimiter
+	LimitNamer *ratelimit.HTTPRemoteNamer
+}
+
+// NewServer creates a server with a fresh log which
+// stores media contents in blobs.
+//
+// If sessionSecret is empty, a random secret is used.
+// The reverseProxies argument is the number of reverse
+// proxies in front of the server, which is used for rate
+// limiting.
+func NewServer(cfg *Config, blobs *BlobStore, sessionSecret string, reverseProxies int) *Server {
+	return &Server{
+		Config:     cfg,
+		Log:        NewLog(cfg, blobs),
+		Uploads:    NewUploadManager(blobs),
+		Thumbnails: NewThumbnailCache(blobs, DefaultThumbnailCache),
+		Sessions:   NewSessionManager(sessionSecret),
+		LoginLimit: ratelimit.NewTimeSliceLimiter(RateLimitDuration, RateLimitAttempts),
+		LimitNamer: &ratelimit.HTTPRemoteNamer{NumProxies: reverseProxies},
+	}
+}
+
+// Handler creates an http.Handler which serves the web UI
+// and the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	handlers := map[string]http.HandlerFunc{
+		"/":                     s.Root,
+		"/login":                s.Login,
+		"/logout":               s.Logout,
+		"/api/getprefs":         s.GetPrefsAPI,
+		"/api/setprefs":         s.SetPrefsAPI,
+		"/api/chpass":           s.ChpassAPI,
+		"/api/add":              s.AddAPI,
+		"/api/addBatch":         s.AddBatchAPI,
+		"/api/addMedia":         s.AddMediaAPI,
+		"/api/uploadMedia":      s.UploadMediaAPI,
+		"/api/startUpload":      s.StartUploadAPI,
+		"/api/uploadChunk":      s.UploadChunkAPI,
+		"/api/uploadStatus":     s.UploadStatusAPI,
+		"/api/finishUpload":     s.FinishUploadAPI,
+		"/api/cancelUpload":     s.CancelUploadAPI,
+		"/api/overview":         s.OverviewAPI,
+		"/api/groupOverview":    s.GroupOverviewAPI,
+		"/api/serviceLabels":    s.ServiceLabelsAPI,
+		"/api/setServiceLabels": s.SetServiceLabelsAPI,
+		"/api/serviceInfo":      s.ServiceInfoAPI,
+		"/api/setServiceInfo":   s.SetServiceInfoAPI,
+		"/api/setProgress":      s.SetProgressAPI,
+		"/api/mediaOverview":    s.MediaOverviewAPI,
+		"/api/fullLog":          s.FullLogAPI,
+		"/api/serviceLog":       s.ServiceLogAPI,
+		"/api/compare":          s.CompareAPI,
+		"/api/mediaLog":         s.MediaLogAPI,
+		"/api/mediaVersions":    s.MediaVersionsAPI,
+		"/api/mediaVersion":     s.MediaVersionAPI,
+		"/api/mediaView":        s.MediaViewAPI,
+		"/api/mediaThumb":       s.MediaThumbAPI,
+		"/api/mediaDiff":        s.MediaDiffAPI,
+		"/api/export":           s.ExportAPI,
+		"/api/import":           s.ImportAPI,
+		"/api/delete":           s.DeleteAPI,
+		"/api/deleteNamespace":  s.DeleteNamespaceAPI,
+		"/api/deleteMedia":      s.DeleteMediaAPI,
+		"/api/serviceStream":    s.ServiceStreamAPI,
+		"/api/fullStream":       s.FullStreamAPI,
+	}
+	for path, f := range handlers {
+		mux.Handle(path, context.ClearHandler(f))
+	}
+	mux.Handle("/assets/", http.StripPrefix("/assets/",
+		http.FileServer(assetFS())))
+	return mux
+}
+
+// Root serves the homepage.
+func (s *Server) Root(w http.ResponseWriter, r *http.Request) {
+	disableCache(w)
+	if r.URL.Path != "" && r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authenticated(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	data, _ := Asset("assets/index.html")
+	w.Write(data)
+}
+
+// Login handles the login system.
+func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
+	disableCache(w)
+	if r.Method == "GET" {
+		w.Header().Set("Content-Type", "text/html")
+		data, _ := Asset("assets/login.html")
+		w.Write(data)
+		return
+	}
+	limitID := s.LimitNamer.Name(r)
+	if s.LoginLimit.Get(limitID) < 0 {
+		http.Error(w, "too many login attempts", http.StatusTooManyRequests)
+		return
+	}
+	pass := r.FormValue("password")
+	if !s.Config.CheckPass(pass) {
+		s.LoginLimit.Decrement(limitID)
+		http.Redirect(w, r, "/login?status=failure", http.StatusSeeOther)
+		return
+	}
+	s.Sessions.CreateSession(w)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Logout serves the logout function.
+func (s *Server) Logout(w http.ResponseWriter, r *http.Request) {
+	disableCache(w)
+	s.Sessions.ClearSession(w)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Server) authenticated(r *http.Request) bool {
+	return s.Sessions.CheckSession(r)
+}
+
+func disableCache(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Pragma", "no-cache")
+	w.Header().Set("Expires", "0")
+}
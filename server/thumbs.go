@@ -0,0 +1,236 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sync"
+
+	"github.com/unixpickle/essentials"
+)
+
+// DefaultThumbnailSize is the default maximum width and
+// height of thumbnails.
+const DefaultThumbnailSize = 256
+
+// MaxThumbnailSize is the largest thumbnail size which may
+// be requested.
+const MaxThumbnailSize = 1024
+
+// DefaultThumbnailCache is the default number of bytes of
+// thumbnails to keep in memory.
+const DefaultThumbnailCache = 64 << 20
+
+// MaxImagePixels is the largest number of pixels in an
+// image which will be decoded for thumbnails and diffs.
+// It prevents small files which claim huge dimensions from
+// exhausting the server's memory.
+const MaxImagePixels = 25000000
+
+// errUnsupportedImage is wrapped by errors for thumbnails
+// of media which are not supported images.
+var errUnsupportedImage = errors.New("unsupported image type")
+
+// errImageTooLarge is wrapped by errors for images with
+// more than MaxImagePixels pixels.
+var errImageTooLarge = errors.New("image is too large")
+
+// isImageMime checks if a MIME type is an image format
+// which can be decoded for thumbnails.
+func isImageMime(mime string) bool {
+	switch mime {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// imageSize returns the dimensions of an image blob, or
+// zeros if the blob is not a supported image.
+func imageSize(blobs *BlobStore, hash, mime string) (width, height int) {
+	if !isImageMime(mime) {
+		return 0, 0
+	}
+	r, err := blobs.Open(hash)
+	if err != nil {
+		return 0, 0
+	}
+	defer r.Close()
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return 0, 0
+	}
+	return cfg.Width, cfg.Height
+}
+
+// A ThumbnailCache generates thumbnails of images and
+// keeps the most recently used ones in memory.
+type ThumbnailCache struct {
+	blobs    *BlobStore
+	maxBytes int
+
+	lock     sync.Mutex
+	entries  map[thumbnailKey]*list.Element
+	lru      *list.List
+	curBytes int
+}
+
+type thumbnailKey struct {
+	Hash string
+	Size int
+}
+
+type thumbnailEntry struct {
+	Key  thumbnailKey
+	Data []byte
+	Mime string
+}
+
+// NewThumbnailCache creates a ThumbnailCache which stores
+// up to maxBytes of thumbnails.
+func NewThumbnailCache(blobs *BlobStore, maxBytes int) *ThumbnailCache {
+	return &ThumbnailCache{
+		blobs:    blobs,
+		maxBytes: maxBytes,
+		entries:  map[thumbnailKey]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+// Thumbnail gets a thumbnail of a media record which fits
+// in a size by size square.
+//
+// It returns the encoded thumbnail and its MIME type.
+// JPEG images produce JPEG thumbnails, and other images
+// produce PNG thumbnails.
+func (t *ThumbnailCache) Thumbnail(record *MediaRecord, size int) ([]byte, string, error) {
+	key := thumbnailKey{Hash: record.SHA256, Size: size}
+	t.lock.Lock()
+	if elem, ok := t.entries[key]; ok {
+		t.lru.MoveToFront(elem)
+		entry := elem.Value.(*thumbnailEntry)
+		t.lock.Unlock()
+		return entry.Data, entry.Mime, nil
+	}
+	t.lock.Unlock()
+
+	data, mime, err := t.generate(record, size)
+	if err != nil {
+		return nil, "", essentials.AddCtx("generate thumbnail", err)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.entries[key]; !ok && len(data) <= t.maxBytes {
+		t.entries[key] = t.lru.PushFront(&thumbnailEntry{Key: key, Data: data, Mime: mime})
+		t.curBytes += len(data)
+		for t.curBytes > t.maxBytes {
+			oldest := t.lru.Remove(t.lru.Back()).(*thumbnailEntry)
+			delete(t.entries, oldest.Key)
+			t.curBytes -= len(oldest.Data)
+		}
+	}
+	return data, mime, nil
+}
+
+func (t *ThumbnailCache) generate(record *MediaRecord, size int) ([]byte, string, error) {
+	r, err := t.blobs.Open(record.SHA256)
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+	img, err := decodeImage(r, record.Mime)
+	if err != nil {
+		return nil, "", err
+	}
+	thumb := resizeImage(img, size)
+
+	var buf bytes.Buffer
+	if record.Mime == "image/jpeg" {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&buf, thumb)
+	return buf.Bytes(), "image/png", err
+}
+
+// decodeImage decodes an image after checking that its
+// dimensions are within MaxImagePixels.
+func decodeImage(r io.ReadSeeker, mime string) (image.Image, error) {
+	var decode func(io.Reader) (image.Image, error)
+	var decodeConfig func(io.Reader) (image.Config, error)
+	switch mime {
+	case "image/png":
+		decode, decodeConfig = png.Decode, png.DecodeConfig
+	case "image/jpeg":
+		decode, decodeConfig = jpeg.Decode, jpeg.DecodeConfig
+	case "image/gif":
+		decode, decodeConfig = gif.Decode, gif.DecodeConfig
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedImage, mime)
+	}
+	cfg, err := decodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxImagePixels {
+		return nil, fmt.Errorf("%w: %dx%d", errImageTooLarge, cfg.Width, cfg.Height)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return decode(r)
+}
+
+// resizeImage shrinks an image to fit in a size by size
+// square by averaging the pixels in each output pixel's
+// area.
+// Images which already fit are returned as-is.
+func resizeImage(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+	newWidth, newHeight := size, size
+	if width > height {
+		newHeight = essentials.MaxInt(1, height*size/width)
+	} else {
+		newWidth = essentials.MaxInt(1, width*size/height)
+	}
+
+	res := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		minY := bounds.Min.Y + y*height/newHeight
+		maxY := essentials.MaxInt(minY+1, bounds.Min.Y+(y+1)*height/newHeight)
+		for x := 0; x < newWidth; x++ {
+			minX := bounds.Min.X + x*width/newWidth
+			maxX := essentials.MaxInt(minX+1, bounds.Min.X+(x+1)*width/newWidth)
+			var sums [4]uint64
+			for srcY := minY; srcY < maxY; srcY++ {
+				for srcX := minX; srcX < maxX; srcX++ {
+					r, g, b, a := img.At(srcX, srcY).RGBA()
+					sums[0] += uint64(r)
+					sums[1] += uint64(g)
+					sums[2] += uint64(b)
+					sums[3] += uint64(a)
+				}
+			}
+			count := uint64((maxY - minY) * (maxX - minX))
+			res.SetRGBA(x, y, color.RGBA{
+				R: uint8(sums[0] / count >> 8),
+				G: uint8(sums[1] / count >> 8),
+				B: uint8(sums[2] / count >> 8),
+				A: uint8(sums[3] / count >> 8),
+			})
+		}
+	}
+	return res
+}
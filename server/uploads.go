@@ -0,0 +1,195 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/unixpickle/essentials"
+)
+
+// UploadTimeout is the amount of time after which an
+// unfinished chunked upload is discarded.
+const UploadTimeout = time.Hour
+
+// errUnknownUpload is wrapped by errors for operations on
+// uploads which do not exist or have expired.
+var errUnknownUpload = errors.New("unknown upload")
+
+// An UploadManager stores the partial contents of chunked
+// media uploads in temporary files.
+//
+// Chunks are identified by their offsets, so re-sending a
+// chunk after a failure is harmless.
+type UploadManager struct {
+	dir string
+
+	lock    sync.Mutex
+	uploads map[string]*pendingUpload
+}
+
+type pendingUpload struct {
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	lastUsed time.Time
+}
+
+// NewUploadManager creates an UploadManager which stores
+// partial uploads in the same directory as blobs.
+func NewUploadManager(blobs *BlobStore) *UploadManager {
+	return &UploadManager{
+		dir:     blobs.dir,
+		uploads: map[string]*pendingUpload{},
+	}
+}
+
+// Start creates a new upload and returns its ID.
+func (u *UploadManager) Start() (string, error) {
+	u.removeExpired()
+
+	var idData [16]byte
+	if _, err := rand.Read(idData[:]); err != nil {
+		return "", essentials.AddCtx("start upload", err)
+	}
+	id := hex.EncodeToString(idData[:])
+	f, err := ioutil.TempFile(u.dir, "upload-")
+	if err != nil {
+		return "", essentials.AddCtx("start upload", err)
+	}
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.uploads[id] = &pendingUpload{file: f, lastUsed: time.Now()}
+	return id, nil
+}
+
+// Append writes a chunk which starts at the given offset
+// and returns the new size of the upload.
+//
+// Any part of the chunk before the current end of the
+// upload is assumed to have been written already.
+func (u *UploadManager) Append(id string, offset int64, r io.Reader) (int64, error) {
+	upload, err := u.get(id)
+	if err != nil {
+		return 0, err
+	}
+	upload.lock.Lock()
+	defer upload.lock.Unlock()
+	if offset > upload.size {
+		return 0, fmt.Errorf("chunk offset %d is past the end of the upload (%d bytes)", offset,
+			upload.size)
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, upload.size-offset); err != nil {
+		return 0, essentials.AddCtx("append to upload", err)
+	}
+	n, err := io.Copy(upload.file, r)
+	upload.size += n
+	upload.lastUsed = time.Now()
+	if err != nil {
+		return 0, essentials.AddCtx("append to upload", err)
+	}
+	return upload.size, nil
+}
+
+// Size returns the number of bytes uploaded so far.
+func (u *UploadManager) Size(id string) (int64, error) {
+	upload, err := u.get(id)
+	if err != nil {
+		return 0, err
+	}
+	upload.lock.Lock()
+	defer upload.lock.Unlock()
+	return upload.size, nil
+}
+
+// Finish ends an upload and returns its contents.
+// The caller must close the result, which deletes the
+// temporary file.
+func (u *UploadManager) Finish(id string) (io.ReadCloser, int64, error) {
+	upload, err := u.remove(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	upload.lock.Lock()
+	defer upload.lock.Unlock()
+	if _, err := upload.file.Seek(0, io.SeekStart); err != nil {
+		upload.discard()
+		return nil, 0, essentials.AddCtx("finish upload", err)
+	}
+	return &uploadReader{File: upload.file}, upload.size, nil
+}
+
+// Cancel discards an upload.
+func (u *UploadManager) Cancel(id string) error {
+	upload, err := u.remove(id)
+	if err != nil {
+		return err
+	}
+	upload.lock.Lock()
+	defer upload.lock.Unlock()
+	upload.discard()
+	return nil
+}
+
+func (u *UploadManager) get(id string) (*pendingUpload, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	upload, ok := u.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownUpload, id)
+	}
+	return upload, nil
+}
+
+func (u *UploadManager) remove(id string) (*pendingUpload, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	upload, ok := u.uploads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownUpload, id)
+	}
+	delete(u.uploads, id)
+	return upload, nil
+}
+
+func (u *UploadManager) removeExpired() {
+	u.lock.Lock()
+	var expired []*pendingUpload
+	for id, upload := range u.uploads {
+		upload.lock.Lock()
+		if time.Since(upload.lastUsed) > UploadTimeout {
+			expired = append(expired, upload)
+			delete(u.uploads, id)
+		}
+		upload.lock.Unlock()
+	}
+	u.lock.Unlock()
+
+	for _, upload := range expired {
+		upload.lock.Lock()
+		upload.discard()
+		upload.lock.Unlock()
+	}
+}
+
+func (p *pendingUpload) discard() {
+	p.file.Close()
+	os.Remove(p.file.Name())
+}
+
+type uploadReader struct {
+	*os.File
+}
+
+func (u *uploadReader) Close() error {
+	err := u.File.Close()
+	os.Remove(u.File.Name())
+	return err
+}
@@ -32,7 +32,7 @@ func ParseFlags() *Flags {
 	flag.StringVar(&fieldNamesString, "fields", "",
 		"optional space-delimited whitelist of field names")
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stderr, "Usage: sh-avg [flags] <service|*> [avg size]")
+		fmt.Fprintln(os.Stderr, "Usage: sh-avg [flags] <service|pattern> [avg size]")
 		fmt.Fprintln(os.Stderr, "")
 		fmt.Fprintln(os.Stderr, "Flags:")
 		flag.PrintDefaults()
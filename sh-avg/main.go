@@ -23,17 +23,12 @@ package main
 import (
 	"fmt"
 	"os"
-	"regexp"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/unixpickle/essentials"
 	"github.com/unixpickle/statushub"
 )
 
-var DefaultAvgSizes = []int{10, 20, 50}
-
 func main() {
 	flags := ParseFlags()
 
@@ -42,7 +37,7 @@ func main() {
 		essentials.Die(err)
 	}
 
-	serviceNames, err := ServiceNames(client, flags.ServiceName)
+	serviceNames, err := statushub.ServiceNames(client, flags.ServiceName)
 	essentials.Must(err)
 
 	for {
@@ -80,7 +75,7 @@ func ProduceAggregates(c *statushub.Client, f *Flags, serviceNames []string) err
 
 		fields := ExtractFields(log)
 		if f.AvgSize == 0 {
-			for _, size := range DefaultAvgSizes {
+			for _, size := range statushub.DefaultAvgSizes {
 				printLine(AggSummary(size, fields, f))
 			}
 		} else {
@@ -96,38 +91,11 @@ func ProduceAggregates(c *statushub.Client, f *Flags, serviceNames []string) err
 // Returns a map from field names to a full history of the
 // values for that field.
 func ExtractFields(log []statushub.LogRecord) map[string][]float64 {
-	exp := regexp.MustCompile(`^([a-zA-Z_0-9\-]*)=([0-9\.\-e]*)$`)
 	res := map[string][]float64{}
 	for _, record := range log {
-		for _, field := range strings.Fields(record.Message) {
-			m := exp.FindStringSubmatch(field)
-			if m == nil {
-				continue
-			}
-			fieldName := m[1]
-			fieldVal := m[2]
-
-			valFloat, err := strconv.ParseFloat(fieldVal, 64)
-			if err == nil {
-				res[fieldName] = append(res[fieldName], valFloat)
-			}
+		for _, field := range statushub.ParseFields(record.Message) {
+			res[field.Name] = append(res[field.Name], field.Value)
 		}
 	}
 	return res
 }
-
-// ServiceNames gets service names matching an expression.
-func ServiceNames(c *statushub.Client, expr string) ([]string, error) {
-	if expr != "*" {
-		return []string{expr}, nil
-	}
-	var serviceNames []string
-	overview, err := c.Overview()
-	if err != nil {
-		return nil, err
-	}
-	for _, x := range overview {
-		serviceNames = append(serviceNames, x.Service)
-	}
-	return serviceNames, nil
-}
@@ -0,0 +1,109 @@
+// Command sh-compare compares the numeric "key=value"
+// fields logged by multiple services, such as different
+// runs of the same experiment.
+//
+// For every field, it prints the final value, the best
+// value and where it occurred, moving averages, and the
+// difference from the first service.
+// Values are aligned by step (or time) so that runs which
+// have progressed different amounts can be compared.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+)
+
+func main() {
+	opts := &statushub.CompareOptions{AlignBy: statushub.AlignStep}
+	var alignTime bool
+	var fields string
+	var maximize string
+	var jsonOutput bool
+	flag.BoolVar(&alignTime, "time", false, "align runs by elapsed time instead of step")
+	flag.StringVar(&opts.StepField, "step", "", "field holding the step of each message")
+	flag.StringVar(&fields, "fields", "", "optional space-delimited whitelist of field names")
+	flag.StringVar(&maximize, "max", "", "space-delimited fields for which higher is better")
+	flag.BoolVar(&jsonOutput, "json", false, "print the raw comparison as JSON")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sh-compare [flags] <service> <service> [...]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "")
+		statushub.PrintEnvUsage(os.Stderr)
+	}
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if alignTime {
+		opts.AlignBy = statushub.AlignTime
+	}
+	opts.Fields = strings.Fields(fields)
+	opts.Maximize = strings.Fields(maximize)
+
+	client, err := statushub.AuthCLI()
+	if err != nil {
+		essentials.Die("Failed to create client:", err)
+	}
+	comparison, err := client.Compare(flag.Args(), opts)
+	if err != nil {
+		essentials.Die(err)
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		essentials.Must(enc.Encode(comparison))
+		return
+	}
+	for i, field := range comparison.Fields {
+		if i > 0 {
+			fmt.Println()
+		}
+		PrintField(field, opts)
+	}
+}
+
+// PrintField prints a table comparing one field across
+// every run.
+func PrintField(f statushub.FieldComparison, opts *statushub.CompareOptions) {
+	unit := "step"
+	if opts.AlignBy == statushub.AlignTime {
+		unit = "second"
+	}
+	fmt.Printf("%s (aligned at %s %d)\n", f.Field, unit, f.Aligned)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	header := "service\tcount\tfinal\tbest\tat\taligned\tdelta\t"
+	for _, size := range statushub.DefaultAvgSizes {
+		header += fmt.Sprintf("avg%d\tdelta%d\t", size, size)
+	}
+	fmt.Fprintln(w, header)
+	for _, run := range f.Runs {
+		if run.Count == 0 {
+			fmt.Fprintf(w, "%s\t0\t\t\t\t\t\t\n", run.Service)
+			continue
+		}
+		at := int64(run.Best.Step)
+		if opts.AlignBy == statushub.AlignTime {
+			at = run.Best.Time
+		}
+		line := fmt.Sprintf("%s\t%d\t%.6g\t%.6g\t%d\t%.6g\t%+.6g\t", run.Service, run.Count,
+			run.Final.Value, run.Best.Value, at, run.AlignedValue, run.Delta)
+		for _, size := range statushub.DefaultAvgSizes {
+			line += fmt.Sprintf("%.6g\t%+.6g\t", run.MovingAvg[size], run.AvgDelta[size])
+		}
+		fmt.Fprintln(w, line)
+	}
+	w.Flush()
+}
@@ -1,16 +1,33 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/unixpickle/essentials"
 	"github.com/unixpickle/statushub"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		essentials.Die("Usage: sh-delete <service> [service ...]")
+	var namespace bool
+	var yes bool
+	flag.BoolVar(&namespace, "namespace", false, "delete every service in each namespace")
+	flag.BoolVar(&yes, "y", false, "delete namespaces without asking for confirmation")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sh-delete [flags] <service|namespace> [...]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr)
+		statushub.PrintEnvUsage(os.Stderr)
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
 	}
 
 	client, err := statushub.AuthCLI()
@@ -18,9 +35,39 @@ func main() {
 		essentials.Die("Failed to create client:", err)
 	}
 
-	for _, service := range os.Args[1:] {
-		if err := client.Delete(service); err != nil {
+	for _, name := range flag.Args() {
+		if namespace {
+			err = deleteNamespace(client, name, yes)
+		} else {
+			err = client.Delete(name)
+		}
+		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 		}
 	}
 }
+
+func deleteNamespace(c *statushub.Client, namespace string, yes bool) error {
+	if !yes {
+		names, err := c.DeleteNamespace(namespace, false)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Services in " + namespace + ":")
+		for _, name := range names {
+			fmt.Println("  " + name)
+		}
+		fmt.Print("Delete these services? [y/N] ")
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer := strings.ToLower(strings.TrimSpace(line)); answer != "y" && answer != "yes" {
+			fmt.Println("Skipped " + namespace)
+			return nil
+		}
+	}
+	names, err := c.DeleteNamespace(namespace, true)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %d services in %s\n", len(names), namespace)
+	return nil
+}
@@ -0,0 +1,52 @@
+// Command sh-export downloads an archive of every
+// service, log record, and media record on a StatusHub
+// server.
+//
+// The archive can be restored with sh-import.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sh-export [output.tar]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "If no output file is specified, the archive is written to stdout.")
+		fmt.Fprintln(os.Stderr, "")
+		statushub.PrintEnvUsage(os.Stderr)
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	client, err := statushub.AuthCLI()
+	if err != nil {
+		essentials.Die("Failed to create client:", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if flag.NArg() == 1 {
+		f, err := os.Create(flag.Arg(0))
+		if err != nil {
+			essentials.Die(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := client.Export(w); err != nil {
+		if flag.NArg() == 1 {
+			os.Remove(flag.Arg(0))
+		}
+		essentials.Die(err)
+	}
+}
@@ -0,0 +1,59 @@
+// Command sh-import uploads an archive created by
+// sh-export to a StatusHub server.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+)
+
+func main() {
+	var opts statushub.ImportOptions
+	var keepIDs bool
+	flag.BoolVar(&opts.Replace, "replace", false,
+		"delete all existing services and media before importing")
+	flag.BoolVar(&keepIDs, "keep-ids", false,
+		"keep the archive's record IDs instead of assigning new ones")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sh-import [flags] [archive.tar]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "If no archive is specified, it is read from stdin.")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "")
+		statushub.PrintEnvUsage(os.Stderr)
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	opts.RemapIDs = !keepIDs
+
+	client, err := statushub.AuthCLI()
+	if err != nil {
+		essentials.Die("Failed to create client:", err)
+	}
+
+	var r io.Reader = os.Stdin
+	if flag.NArg() == 1 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			essentials.Die(err)
+		}
+		defer f.Close()
+		r = f
+	}
+	stats, err := client.Import(r, opts)
+	if err != nil {
+		essentials.Die(err)
+	}
+	fmt.Printf("Imported %d services, %d records, and %d media records.\n",
+		stats.Services, stats.Records, stats.Media)
+}
@@ -4,18 +4,27 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/unixpickle/statushub"
 )
 
 type Flags struct {
-	ServiceName   string
-	AddTimestamps bool
-	Timezone      string
-	LineInterval  int
-	Filter        string
-	Buffer        int
-	Clear         bool
+	ServiceName    string
+	AddTimestamps  bool
+	Timezone       string
+	LineInterval   int
+	Filter         string
+	Buffer         int
+	Clear          bool
+	InferLevels    bool
+	DetectProgress bool
+	Labels         statushub.Labels
+	RunInfo        bool
+	EnvNames       []string
+	MediaLines     bool
+	MediaFolder    string
+	MediaDir       string
 }
 
 func ParseFlags() (f *Flags, args []string) {
@@ -27,6 +36,21 @@ func ParseFlags() (f *Flags, args []string) {
 	flag.StringVar(&f.Filter, "filter", "", "regular expression to filter for log messages")
 	flag.IntVar(&f.Buffer, "buffer", 100, "log message buffer size")
 	flag.BoolVar(&f.Clear, "clear", false, "clear the log before starting")
+	flag.BoolVar(&f.InferLevels, "levels", true, "infer log levels from message prefixes")
+	flag.BoolVar(&f.DetectProgress, "progress", false,
+		"report progress from messages like \"12/500\" or \"40%\"")
+	flag.Var(&f.Labels, "label", "label to attach to every message (key=value, repeatable)")
+	flag.BoolVar(&f.RunInfo, "info", false, "attach the command line, directory and host "+
+		"to the service info")
+	flag.BoolVar(&f.MediaLines, "media", false,
+		"upload files named by lines like \"@media path.png\" and attach them to the lines")
+	flag.StringVar(&f.MediaFolder, "media-folder", "",
+		"media folder for uploaded files (default: the service name)")
+	flag.StringVar(&f.MediaDir, "media-dir", ".",
+		"directory which files named by media lines must be inside")
+	var envNames string
+	flag.StringVar(&envNames, "env", "", "comma-separated environment variables (or globs) "+
+		"to attach to the service info (implies -info)")
 	flag.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage: sh-log [flags] <service> [cmd [args...]]")
 		fmt.Fprintln(os.Stderr, "")
@@ -41,6 +65,13 @@ func ParseFlags() (f *Flags, args []string) {
 		os.Exit(1)
 	}
 	f.ServiceName = flag.Args()[0]
+	if f.MediaFolder == "" {
+		f.MediaFolder = f.ServiceName
+	}
+	if envNames != "" {
+		f.EnvNames = strings.Split(envNames, ",")
+		f.RunInfo = true
+	}
 
 	return f, flag.Args()[1:]
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// RunInfo is the service info which sh-log attaches to a
+// service before logging.
+type RunInfo struct {
+	Command   []string          `json:"command,omitempty"`
+	Dir       string            `json:"dir,omitempty"`
+	Host      string            `json:"host,omitempty"`
+	StartTime int64             `json:"startTime"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// NewRunInfo creates a RunInfo for the command and the
+// selected environment variables.
+//
+// Each entry of envNames is a variable name or a glob
+// pattern, such as "CUDA_*".
+func NewRunInfo(command []string, envNames []string) *RunInfo {
+	info := &RunInfo{
+		Command:   command,
+		StartTime: time.Now().Unix(),
+	}
+	info.Dir, _ = os.Getwd()
+	info.Host, _ = os.Hostname()
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		for _, pattern := range envNames {
+			if matched, _ := path.Match(pattern, parts[0]); matched {
+				if info.Env == nil {
+					info.Env = map[string]string{}
+				}
+				info.Env[parts[0]] = parts[1]
+				break
+			}
+		}
+	}
+	return info
+}
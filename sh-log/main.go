@@ -27,6 +27,13 @@ func main() {
 		client.Delete(flags.ServiceName)
 	}
 
+	if flags.RunInfo {
+		info := NewRunInfo(args, flags.EnvNames)
+		if err := client.SetServiceInfo(flags.ServiceName, info); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to set service info:", err)
+		}
+	}
+
 	pipelineIn, pipelineOut := Pipeline(flags)
 
 	go func() {
@@ -47,25 +54,45 @@ func submitMessages(c *statushub.Client, f *Flags, messages <-chan *Message) {
 		if len(msgs) == 0 {
 			return
 		}
-		if _, err := c.AddBatch(f.ServiceName, unfilteredMessages(msgs)); err != nil {
+		uploadMedia(c, f, msgs)
+		if _, err := c.AddEntries(f.ServiceName, unfilteredEntries(msgs, f.Labels)); err != nil {
 			fmt.Fprintln(os.Stderr, "Failed to log:", err)
 		}
+		if p := latestProgress(msgs); p != nil {
+			if err := c.SetProgress(f.ServiceName, p.Done, p.Total); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to set progress:", err)
+			}
+		}
 		for _, msg := range msgs {
 			fmt.Fprintln(msg.Dest, msg.Line)
 		}
 	}
 }
 
-func unfilteredMessages(msgs []*Message) []string {
-	res := []string{}
+func unfilteredEntries(msgs []*Message, labels statushub.Labels) []statushub.Entry {
+	res := []statushub.Entry{}
 	for _, msg := range msgs {
 		if !msg.Filtered {
-			res = append(res, msg.Line)
+			res = append(res, statushub.Entry{
+				Message:  msg.Line,
+				Level:    msg.Level,
+				Labels:   labels,
+				MediaIDs: msg.MediaIDs,
+			})
 		}
 	}
 	return res
 }
 
+func latestProgress(msgs []*Message) *statushub.Progress {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Progress != nil {
+			return msgs[i].Progress
+		}
+	}
+	return nil
+}
+
 func logCommand(msgCh chan<- *Message, name string, args ...string) {
 	cmd := exec.Command(name, args...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
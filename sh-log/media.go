@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+)
+
+// uploadMedia uploads the files named by unfiltered
+// messages, and attaches the resulting media IDs to the
+// messages.
+//
+// Failures are reported on stderr, and the messages are
+// still logged without media.
+func uploadMedia(c *statushub.Client, f *Flags, msgs []*Message) {
+	for _, msg := range msgs {
+		if msg.MediaPath == "" || msg.Filtered {
+			continue
+		}
+		id, err := uploadFile(c, f.MediaFolder, f.MediaDir, msg.MediaPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to upload media:", err)
+			continue
+		}
+		msg.MediaIDs = []int{id}
+	}
+}
+
+func uploadFile(c *statushub.Client, folder, dir, path string) (int, error) {
+	resolved, err := resolveMediaPath(dir, path)
+	if err != nil {
+		return 0, err
+	}
+	// Check the file before opening it, since opening a
+	// named pipe could block forever.
+	if info, err := os.Stat(resolved); err != nil {
+		return 0, err
+	} else if !info.Mode().IsRegular() {
+		return 0, errors.New("not a regular file: " + path)
+	}
+	file, err := os.Open(resolved)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	filename := filepath.Base(path)
+	mimeType := mime.TypeByExtension(filepath.Ext(filename))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return c.AddMediaReader(folder, filename, mimeType, file, info.Size(), false)
+}
+
+// resolveMediaPath resolves the path from a media line,
+// following symbolic links, and checks that the file is
+// inside dir.
+//
+// Relative paths are relative to the working directory,
+// like the paths printed by a logged command.
+func resolveMediaPath(dir, path string) (res string, err error) {
+	defer essentials.AddCtxTo("resolve "+path, &err)
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return "", err
+	}
+	if res, err = filepath.EvalSymlinks(path); err != nil {
+		return "", err
+	}
+	if res, err = filepath.Abs(res); err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, res)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("file is outside of the media directory")
+	}
+	return res, nil
+}
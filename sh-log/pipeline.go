@@ -3,9 +3,12 @@ package main
 import (
 	"io"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
 )
 
 const LogTimeFormat = "2006/01/02 15:04:05"
@@ -22,6 +25,22 @@ type Message struct {
 	// Filtered is set to true if the log message should
 	// not be sent to the server.
 	Filtered bool
+
+	// Level is the log level to send to the server.
+	Level statushub.Level
+
+	// Progress is set if the message reports progress.
+	// Only Done and Total are used.
+	Progress *statushub.Progress
+
+	// MediaPath is set if the message asks for a local
+	// file to be uploaded.
+	// Such messages are subject to the filter, but they are
+	// never skipped by TakeInterval.
+	MediaPath string
+
+	// MediaIDs lists the media uploaded for the message.
+	MediaIDs []int
 }
 
 // Pipeline creates a message processing pipeline based on
@@ -29,6 +48,15 @@ type Message struct {
 func Pipeline(f *Flags) (chan<- *Message, <-chan *Message) {
 	input := make(chan *Message, 1)
 	var output <-chan *Message = input
+	if f.MediaLines {
+		output = DetectMedia(output)
+	}
+	if f.InferLevels {
+		output = InferLevels(output)
+	}
+	if f.DetectProgress {
+		output = DetectProgress(output)
+	}
 	if f.AddTimestamps {
 		output = AddTimestamps(output, f.Timezone)
 	}
@@ -80,6 +108,68 @@ func AddTimestamps(messages <-chan *Message, timezone string) <-chan *Message {
 	})
 }
 
+// InferLevels is a pipeline stage that sets the level of
+// log messages based on common prefixes like "ERROR" and
+// "WARNING".
+// Every line of a Python traceback is an error.
+func InferLevels(messages <-chan *Message) <-chan *Message {
+	errorExpr := regexp.MustCompile(`^[\s\[(]*(ERROR|FATAL|CRITICAL|PANIC)\b|^panic: `)
+	warnExpr := regexp.MustCompile(`^[\s\[(]*(WARN|WARNING)\b`)
+	tracebackExpr := regexp.MustCompile(`^Traceback \(most recent call last\):`)
+	inTraceback := false
+	return pipelineStage(messages, func(msg *Message) {
+		if inTraceback {
+			// The traceback ends with the first unindented line,
+			// which contains the exception.
+			msg.Level = statushub.LevelError
+			inTraceback = len(msg.Line) > 0 && (msg.Line[0] == ' ' || msg.Line[0] == '\t')
+		} else if tracebackExpr.MatchString(msg.Line) {
+			msg.Level = statushub.LevelError
+			inTraceback = true
+		} else if errorExpr.MatchString(msg.Line) {
+			msg.Level = statushub.LevelError
+		} else if warnExpr.MatchString(msg.Line) {
+			msg.Level = statushub.LevelWarn
+		}
+	})
+}
+
+// DetectProgress is a pipeline stage that finds progress
+// in log messages of the form "N/M" (e.g. "step 12/500")
+// or "P%".
+//
+// If a message contains both, "N/M" takes precedence.
+func DetectProgress(messages <-chan *Message) <-chan *Message {
+	fractionExpr := regexp.MustCompile(`(?:^|[^\d/.])(\d+)\s*/\s*(\d+)(?:$|[^\d/.])`)
+	percentExpr := regexp.MustCompile(`(?:^|[^\d.])(\d+(?:\.\d+)?)\s*%`)
+	return pipelineStage(messages, func(msg *Message) {
+		for _, m := range fractionExpr.FindAllStringSubmatch(msg.Line, -1) {
+			done, _ := strconv.ParseFloat(m[1], 64)
+			total, _ := strconv.ParseFloat(m[2], 64)
+			if total > 0 && done <= total {
+				msg.Progress = &statushub.Progress{Done: done, Total: total}
+				return
+			}
+		}
+		if m := percentExpr.FindStringSubmatch(msg.Line); m != nil {
+			done, _ := strconv.ParseFloat(m[1], 64)
+			if done <= 100 {
+				msg.Progress = &statushub.Progress{Done: done, Total: 100}
+			}
+		}
+	})
+}
+
+// DetectMedia is a pipeline stage that finds messages of
+// the form "@media path", which name files to upload.
+func DetectMedia(messages <-chan *Message) <-chan *Message {
+	return pipelineStage(messages, func(msg *Message) {
+		if strings.HasPrefix(msg.Line, statushub.MediaMessagePrefix) {
+			msg.MediaPath = strings.TrimSpace(msg.Line[len(statushub.MediaMessagePrefix):])
+		}
+	})
+}
+
 // Filter is a pipeline stage that filters log messages
 // for a given regular expression.
 func Filter(messages <-chan *Message, filter string) <-chan *Message {
@@ -95,10 +185,11 @@ func Filter(messages <-chan *Message, filter string) <-chan *Message {
 
 // TakeInterval is a pipeline stage that filters every log
 // message except for every n-th one.
+// Media messages are always kept.
 func TakeInterval(messages <-chan *Message, interval int) <-chan *Message {
 	var lineIndex int
 	return pipelineStage(messages, func(msg *Message) {
-		if !msg.Filtered {
+		if !msg.Filtered && msg.MediaPath == "" {
 			msg.Filtered = (lineIndex%interval != 0)
 			lineIndex++
 		}
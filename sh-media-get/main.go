@@ -0,0 +1,180 @@
+// Command sh-media-get lists and downloads media from a
+// StatusHub server.
+//
+// With no arguments, it lists the media folders.
+// With a folder, it lists the files in the folder, or
+// downloads them to a directory if -o is passed.
+// With a folder and a filename, it downloads the file.
+//
+// The -follow flag keeps downloading new media as it
+// arrives, keeping a local directory in sync with the
+// server.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+)
+
+type Flags struct {
+	Folder   string
+	Filename string
+
+	Output    string
+	Version   int
+	Versions  bool
+	Recursive bool
+	Follow    bool
+	Interval  time.Duration
+}
+
+func ParseFlags() *Flags {
+	f := &Flags{}
+	flag.StringVar(&f.Output, "o", "", "output file or directory (- for stdout)")
+	flag.IntVar(&f.Version, "version", 0, "version of the file to download (default: latest)")
+	flag.BoolVar(&f.Versions, "versions", false,
+		"download every version of each file as name.vN.ext")
+	flag.BoolVar(&f.Recursive, "r", false, "include folders nested inside the folder")
+	flag.BoolVar(&f.Follow, "follow", false, "keep downloading new media as it arrives")
+	flag.DurationVar(&f.Interval, "interval", 5*time.Second, "interval at which to check "+
+		"for new media when following")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sh-media-get [flags]")
+		fmt.Fprintln(os.Stderr, "       sh-media-get [flags] <folder>")
+		fmt.Fprintln(os.Stderr, "       sh-media-get [flags] -o <dir> <folder>")
+		fmt.Fprintln(os.Stderr, "       sh-media-get [flags] <folder> <filename>")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Without -o, a folder's files are listed rather than downloaded.")
+		fmt.Fprintln(os.Stderr, "Nested folders like <folder>/a/b are downloaded to <dir>/a/b.")
+		fmt.Fprintln(os.Stderr, "Local files are never deleted.")
+		fmt.Fprintln(os.Stderr, "")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "")
+		statushub.PrintEnvUsage(os.Stderr)
+	}
+	flag.Parse()
+
+	if flag.NArg() > 2 || (flag.NArg() == 2 && flag.Arg(1) == "") {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if flag.NArg() > 0 {
+		f.Folder = flag.Arg(0)
+	}
+	if flag.NArg() > 1 {
+		f.Filename = flag.Arg(1)
+		if f.Output == "" {
+			// The file is saved under its name on the server.
+			f.Output = "."
+		}
+	}
+	if f.Version != 0 && (f.Filename == "" || f.Follow || f.Versions) {
+		essentials.Die("The -version flag requires a filename and cannot be used with " +
+			"-follow or -versions.")
+	}
+	if f.Output == "-" && (f.Filename == "" || f.Follow || f.Versions) {
+		essentials.Die("Only a single file can be written to stdout.")
+	}
+	if f.Follow && f.Output == "" {
+		essentials.Die("The -follow flag requires a folder and an output directory.")
+	}
+	return f
+}
+
+func main() {
+	flags := ParseFlags()
+
+	client, err := statushub.AuthCLI()
+	if err != nil {
+		essentials.Die("Failed to create client:", err)
+	}
+
+	if flags.Folder == "" {
+		ListFolders(client)
+		return
+	} else if flags.Output == "" {
+		ListFiles(client, flags.Folder)
+		return
+	}
+
+	syncer := NewSyncer(client, flags)
+	if !flags.Follow {
+		if err := syncer.Sync(); err != nil {
+			essentials.Die(err)
+		}
+		return
+	}
+	for {
+		if err := syncer.Sync(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		time.Sleep(flags.Interval)
+	}
+}
+
+// ListFolders prints every media folder with its newest
+// file.
+func ListFolders(client *statushub.Client) {
+	overview, err := client.MediaOverview()
+	if err != nil {
+		essentials.Die(err)
+	}
+	sort.Slice(overview, func(i, j int) bool {
+		return overview[i].Folder < overview[j].Folder
+	})
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FOLDER\tUPDATED\tLATEST\tSIZE")
+	for _, record := range overview {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", record.Folder, FormatTime(record.Time),
+			record.Filename, FormatSize(record.Size))
+	}
+	w.Flush()
+}
+
+// ListFiles prints the files in a media folder, from
+// newest to oldest.
+func ListFiles(client *statushub.Client, folder string) {
+	records, err := client.MediaLog(folder)
+	if err != nil {
+		essentials.Die(err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tVERSION\tSIZE\tDIMENSIONS\tTYPE\tFILENAME")
+	for _, record := range records {
+		dims := "-"
+		if record.Width != 0 || record.Height != 0 {
+			dims = fmt.Sprintf("%dx%d", record.Width, record.Height)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\t%s\n", record.ID, FormatTime(record.Time),
+			record.Version, FormatSize(record.Size), dims, record.Mime, record.Filename)
+	}
+	w.Flush()
+}
+
+// FormatTime formats a record timestamp in local time.
+func FormatTime(t int64) string {
+	return time.Unix(t, 0).Format("2006-01-02 15:04:05")
+}
+
+// FormatSize formats a number of bytes for humans.
+func FormatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1000 && unit+1 < len(units) {
+		value /= 1000
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, units[0])
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + " " + units[unit]
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+)
+
+// A Syncer downloads media records to local files.
+//
+// Files are only downloaded if they are missing or out of
+// date, so syncing repeatedly only fetches new media.
+type Syncer struct {
+	Client *statushub.Client
+	Flags  *Flags
+
+	// synced maps local paths to the IDs of the records
+	// which were downloaded to them.
+	synced map[string]int
+}
+
+// NewSyncer creates a Syncer for the flags.
+func NewSyncer(client *statushub.Client, flags *Flags) *Syncer {
+	return &Syncer{Client: client, Flags: flags, synced: map[string]int{}}
+}
+
+// Sync downloads every new or updated record.
+func (s *Syncer) Sync() error {
+	if s.Flags.Filename != "" {
+		return s.syncFile()
+	}
+	folders, err := s.folders()
+	if err != nil {
+		return err
+	}
+	for _, folder := range folders {
+		records, err := s.Client.MediaLog(folder)
+		if errors.Is(err, statushub.ErrUnknownMedia) {
+			// The folder may have been deleted, or it may
+			// not have been created yet.
+			continue
+		} else if err != nil {
+			return err
+		}
+		dir, ok := s.localDir(folder)
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Skipping folder with unsafe name:", folder)
+			continue
+		}
+		records, err = s.selectRecords(folder, records)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if !safeName(record.Filename) {
+				fmt.Fprintln(os.Stderr, "Skipping file with unsafe name:", record.Filename)
+				continue
+			}
+			name := record.Filename
+			if s.Flags.Versions {
+				name = versionName(name, record.Version)
+			}
+			if err := s.download(record, filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Syncer) syncFile() error {
+	var records []statushub.MediaRecord
+	if s.Flags.Versions {
+		var err error
+		records, err = s.Client.MediaVersions(s.Flags.Folder, s.Flags.Filename)
+		if err != nil {
+			return err
+		}
+	} else {
+		record, err := s.Client.MediaVersion(s.Flags.Folder, s.Flags.Filename, s.Flags.Version)
+		if err != nil {
+			return err
+		}
+		records = append(records, *record)
+	}
+	if s.Flags.Output == "-" {
+		return s.Client.MediaView(records[0].ID, os.Stdout)
+	}
+	for _, record := range records {
+		path := s.Flags.Output
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			if !safeName(record.Filename) {
+				return errors.New("unsafe filename: " + record.Filename)
+			}
+			path = filepath.Join(path, record.Filename)
+		}
+		if s.Flags.Versions {
+			path = versionName(path, record.Version)
+		}
+		if err := s.download(record, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// folders lists the server folders to sync.
+func (s *Syncer) folders() ([]string, error) {
+	if !s.Flags.Recursive {
+		return []string{s.Flags.Folder}, nil
+	}
+	overview, err := s.Client.MediaOverview()
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, record := range overview {
+		if statushub.InNamespace(record.Folder, s.Flags.Folder) {
+			res = append(res, record.Folder)
+		}
+	}
+	return res, nil
+}
+
+// localDir finds the local directory for a server folder.
+func (s *Syncer) localDir(folder string) (string, bool) {
+	rel := strings.TrimPrefix(folder, s.Flags.Folder)
+	if rel == "" {
+		return s.Flags.Output, true
+	}
+	parts := strings.Split(strings.TrimPrefix(rel, statushub.NamespaceSeparator),
+		statushub.NamespaceSeparator)
+	for _, part := range parts {
+		if !safeName(part) {
+			return "", false
+		}
+	}
+	return filepath.Join(append([]string{s.Flags.Output}, parts...)...), true
+}
+
+// selectRecords chooses which records from a folder to
+// download, given the folder's media log.
+func (s *Syncer) selectRecords(folder string,
+	records []statushub.MediaRecord) ([]statushub.MediaRecord, error) {
+	var res []statushub.MediaRecord
+	seen := map[string]bool{}
+	for _, record := range records {
+		if seen[record.Filename] {
+			continue
+		}
+		seen[record.Filename] = true
+		if !s.Flags.Versions {
+			res = append(res, record)
+			continue
+		}
+		// The media log omits replaced versions.
+		versions, err := s.Client.MediaVersions(folder, record.Filename)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, versions...)
+	}
+	return res, nil
+}
+
+// download saves a record to a local path unless the path
+// already holds the record.
+//
+// Downloaded files are given the modification time of the
+// record, so that they are not downloaded again when the
+// command is re-run.
+func (s *Syncer) download(record statushub.MediaRecord, path string) (err error) {
+	if id, ok := s.synced[path]; ok && id == record.ID {
+		return nil
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() == record.Size &&
+		info.ModTime().Unix() == record.Time {
+		s.synced[path] = record.ID
+		return nil
+	}
+	defer essentials.AddCtxTo("download "+record.Folder+"/"+record.Filename, &err)
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, ".sh-media-get-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = s.Client.MediaView(record.ID, tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	modTime := time.Unix(record.Time, 0)
+	if err := os.Chtimes(tmp.Name(), modTime, modTime); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	s.synced[path] = record.ID
+	fmt.Println(path)
+	return nil
+}
+
+// safeName checks that a name from the server is a single
+// path component, so that it cannot escape the output
+// directory.
+func safeName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
+
+// versionName inserts a version number before the
+// extension of a filename, as in "sample.v3.png".
+func versionName(name string, version int) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + ".v" + strconv.Itoa(version) + ext
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"mime"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/unixpickle/essentials"
 	"github.com/unixpickle/statushub"
@@ -16,16 +19,47 @@ type Flags struct {
 	Name        string
 	Filename    string
 	UseFilename string
+	Mime        string
 	Replace     bool
+	Verify      bool
+
+	Watch        string
+	Include      []string
+	Exclude      []string
+	Debounce     time.Duration
+	Poll         bool
+	PollInterval time.Duration
+	Existing     bool
 }
 
 func ParseFlags() *Flags {
 	f := &Flags{}
 
+	var include, exclude string
 	flag.StringVar(&f.UseFilename, "filename", "", "override the filename sent to the server")
+	flag.StringVar(&f.Mime, "mime", "", "override the MIME type sent to the server")
 	flag.BoolVar(&f.Replace, "replace", false, "replace other files with the same name")
+	flag.BoolVar(&f.Verify, "verify", false, "download each upload and compare it to the local data")
+	flag.StringVar(&f.Watch, "watch", "", "upload new and changed files in a directory")
+	flag.StringVar(&include, "include", "", "comma-separated globs of files to watch")
+	flag.StringVar(&exclude, "exclude", ".*", "comma-separated globs of files not to watch")
+	flag.DurationVar(&f.Debounce, "debounce", 2*time.Second,
+		"time a watched file must be unchanged before it is uploaded")
+	flag.BoolVar(&f.Poll, "poll", false, "poll the watched directory instead of using inotify")
+	flag.DurationVar(&f.PollInterval, "poll-interval", time.Second,
+		"interval at which to poll the watched directory")
+	flag.BoolVar(&f.Existing, "existing", false, "upload files which exist when watching starts")
 	flag.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage: sh-media [flags] <name> <file>")
+		fmt.Fprintln(os.Stderr, "       sh-media [flags] -watch <dir> <name>")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "If the file is -, it is read from stdin.")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "The exit status is 1 if the upload fails, or 2 if the upload")
+		fmt.Fprintln(os.Stderr, "succeeds but -verify finds that the server has different data.")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "In watch mode, files in a subdirectory of the watched")
+		fmt.Fprintln(os.Stderr, "directory are uploaded to <name>/<subdirectory>.")
 		fmt.Fprintln(os.Stderr, "")
 		flag.PrintDefaults()
 		fmt.Fprintln(os.Stderr, "")
@@ -33,6 +67,25 @@ func ParseFlags() *Flags {
 	}
 
 	flag.Parse()
+	if include != "" {
+		f.Include = strings.Split(include, ",")
+	}
+	if exclude != "" {
+		f.Exclude = strings.Split(exclude, ",")
+	}
+
+	if f.Watch != "" {
+		if len(flag.Args()) != 1 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		if f.UseFilename != "" {
+			essentials.Die("The -filename flag cannot be used with -watch.")
+		}
+		f.Name = flag.Args()[0]
+		return f
+	}
+
 	if len(flag.Args()) != 2 {
 		flag.Usage()
 		os.Exit(1)
@@ -41,6 +94,9 @@ func ParseFlags() *Flags {
 	f.Filename = flag.Args()[1]
 
 	if f.UseFilename == "" {
+		if f.Filename == "-" {
+			essentials.Die("The -filename flag is required when reading from stdin.")
+		}
 		f.UseFilename = filepath.Base(f.Filename)
 	}
 
@@ -55,15 +111,43 @@ func main() {
 		essentials.Die("Failed to create client:", err)
 	}
 
-	contents, err := ioutil.ReadFile(flags.Filename)
-	if err != nil {
-		essentials.Die("Failed to read file:", err)
+	if flags.Watch != "" {
+		RunWatch(client, flags)
+		return
 	}
 
-	mime := mime.TypeByExtension(filepath.Ext(flags.UseFilename))
-	if mime == "" {
-		mime = "application/octet-stream"
+	var contents io.Reader = os.Stdin
+	size := int64(-1)
+	if flags.Filename != "-" {
+		f, err := os.Open(flags.Filename)
+		if err != nil {
+			essentials.Die("Failed to read file:", err)
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			essentials.Die("Failed to read file:", err)
+		}
+		contents = f
+		size = info.Size()
 	}
 
-	client.AddMedia(flags.Name, flags.UseFilename, mime, contents, flags.Replace)
+	_, err = Upload(client, flags, flags.Name, flags.UseFilename, contents, size)
+	if errors.Is(err, errVerifyFailed) {
+		fmt.Fprintln(os.Stderr, "Failed to verify upload:", err)
+		os.Exit(2)
+	} else if err != nil {
+		essentials.Die("Failed to upload:", err)
+	}
+}
+
+// MimeType determines the MIME type to send for a file.
+func (f *Flags) MimeType(filename string) string {
+	if f.Mime != "" {
+		return f.Mime
+	}
+	if mimeType := mime.TypeByExtension(filepath.Ext(filename)); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
 }
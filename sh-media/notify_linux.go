@@ -0,0 +1,105 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CLOSE_WRITE | unix.IN_MODIFY | unix.IN_MOVED_TO | unix.IN_CREATE
+
+type inotifyWatcher struct {
+	fd      int
+	dirs    map[int]string
+	changes chan<- string
+}
+
+// notifyChanges uses inotify to report files in a
+// directory tree which have been created or changed.
+func notifyChanges(root string, changes chan<- string) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	w := &inotifyWatcher{fd: fd, dirs: map[int]string{}, changes: changes}
+	if err := w.addTree(root, false); err != nil {
+		unix.Close(fd)
+		return err
+	}
+	go w.run(root)
+	return nil
+}
+
+// addTree watches a directory and its subdirectories.
+// If report is true, the files in the tree are reported as
+// changed, since they may have been created before the
+// watch was added.
+func (w *inotifyWatcher) addTree(root string, report bool) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil
+		}
+		if info.IsDir() {
+			wd, err := unix.InotifyAddWatch(w.fd, path, inotifyMask)
+			if err != nil {
+				return err
+			}
+			w.dirs[wd] = path
+		} else if report {
+			w.changes <- path
+		}
+		return nil
+	})
+}
+
+func (w *inotifyWatcher) run(root string) {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := unix.Read(w.fd, buf)
+		if err == unix.EINTR {
+			continue
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to read file notifications:", err)
+			os.Exit(1)
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+int(event.Len)]), "\x00")
+			offset = nameStart + int(event.Len)
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				// Events were lost, so every file might have
+				// changed.
+				w.addTree(root, true)
+				continue
+			}
+			if event.Mask&unix.IN_IGNORED != 0 {
+				delete(w.dirs, int(event.Wd))
+				continue
+			}
+			dir, ok := w.dirs[int(event.Wd)]
+			if !ok || name == "" {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			if event.Mask&unix.IN_ISDIR != 0 {
+				if event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+					w.addTree(path, true)
+				}
+				continue
+			}
+			w.changes <- path
+		}
+	}
+}
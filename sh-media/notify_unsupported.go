@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+func notifyChanges(root string, changes chan<- string) error {
+	_ = root
+	_ = changes
+	return errors.New("file notifications are not supported on this platform")
+}
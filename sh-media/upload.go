@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+)
+
+// errVerifyFailed is wrapped by errors for uploads whose
+// contents on the server differ from the local data.
+var errVerifyFailed = errors.New("verification failed")
+
+// Upload uploads a media record and returns its ID.
+//
+// If the flags ask for verification, the record is then
+// downloaded and compared to the uploaded data.
+func Upload(client *statushub.Client, flags *Flags, folder, filename string, r io.Reader,
+	size int64) (int, error) {
+	hasher := sha256.New()
+	id, err := client.AddMediaReader(folder, filename, flags.MimeType(filename),
+		io.TeeReader(r, hasher), size, flags.Replace)
+	if err != nil || !flags.Verify {
+		return id, err
+	}
+
+	expected := hex.EncodeToString(hasher.Sum(nil))
+	hasher.Reset()
+	if err := client.MediaView(id, hasher); err != nil {
+		return id, essentials.AddCtx("verify upload", err)
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != expected {
+		return id, fmt.Errorf("%w: uploaded SHA-256 %s but downloaded %s", errVerifyFailed,
+			expected, actual)
+	}
+	return id, nil
+}
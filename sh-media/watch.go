@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+)
+
+// MinCheckInterval is the shortest interval at which
+// pending files are checked for uploading.
+const MinCheckInterval = 50 * time.Millisecond
+
+type fileState struct {
+	Size    int64
+	ModTime time.Time
+}
+
+type pendingFile struct {
+	LastChange time.Time
+	State      fileState
+}
+
+// A Watcher uploads the files in a directory as they are
+// created or changed.
+type Watcher struct {
+	Client *statushub.Client
+	Flags  *Flags
+
+	uploaded map[string]fileState
+	pending  map[string]*pendingFile
+}
+
+// RunWatch watches the directory from the flags forever.
+func RunWatch(client *statushub.Client, flags *Flags) {
+	w := &Watcher{
+		Client:   client,
+		Flags:    flags,
+		uploaded: map[string]fileState{},
+		pending:  map[string]*pendingFile{},
+	}
+
+	changes := make(chan string, 100)
+	if flags.Poll {
+		go pollChanges(flags.Watch, flags.PollInterval, changes)
+	} else if err := notifyChanges(flags.Watch, changes); err != nil {
+		fmt.Fprintln(os.Stderr, "Falling back to polling:", err)
+		go pollChanges(flags.Watch, flags.PollInterval, changes)
+	}
+
+	existing, err := scanTree(flags.Watch)
+	if err != nil {
+		essentials.Die("Failed to read directory:", err)
+	}
+	for path, state := range existing {
+		if flags.Existing {
+			w.fileChanged(path)
+		} else {
+			w.uploaded[path] = state
+		}
+	}
+
+	checkInterval := flags.Debounce / 4
+	if checkInterval < MinCheckInterval {
+		checkInterval = MinCheckInterval
+	}
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case path := <-changes:
+			w.fileChanged(path)
+		case <-ticker.C:
+			w.uploadPending()
+		}
+	}
+}
+
+func (w *Watcher) fileChanged(path string) {
+	if !w.shouldWatch(path) {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		delete(w.pending, path)
+		return
+	}
+	w.pending[path] = &pendingFile{
+		LastChange: time.Now(),
+		State:      fileState{Size: info.Size(), ModTime: info.ModTime()},
+	}
+}
+
+// uploadPending uploads the files which have not changed
+// for the debounce interval.
+func (w *Watcher) uploadPending() {
+	for path, pending := range w.pending {
+		if time.Since(pending.LastChange) < w.Flags.Debounce {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			delete(w.pending, path)
+			continue
+		}
+		state := fileState{Size: info.Size(), ModTime: info.ModTime()}
+		if state != pending.State {
+			// The file changed without an event, e.g. because
+			// of polling, so we wait for it to settle again.
+			pending.State = state
+			pending.LastChange = time.Now()
+			continue
+		}
+		delete(w.pending, path)
+		if state == w.uploaded[path] {
+			continue
+		}
+		if err := w.upload(path, info.Size()); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to upload "+path+":", err)
+			continue
+		}
+		w.uploaded[path] = state
+	}
+}
+
+func (w *Watcher) upload(path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = Upload(w.Client, w.Flags, w.folderName(path), filepath.Base(path), f, size)
+	return err
+}
+
+// folderName maps subdirectories of the watched directory
+// to media folders inside the folder from the flags.
+func (w *Watcher) folderName(path string) string {
+	rel, err := filepath.Rel(w.Flags.Watch, filepath.Dir(path))
+	if err != nil || rel == "." {
+		return w.Flags.Name
+	}
+	return w.Flags.Name + statushub.NamespaceSeparator + filepath.ToSlash(rel)
+}
+
+// shouldWatch checks a file against the include and
+// exclude globs.
+//
+// Globs match either the file's base name or its path
+// relative to the watched directory.
+// Exclude globs also match parent directories.
+func (w *Watcher) shouldWatch(filePath string) bool {
+	rel, err := filepath.Rel(w.Flags.Watch, filePath)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	components := strings.Split(rel, "/")
+	for _, glob := range w.Flags.Exclude {
+		if matchGlob(glob, rel) {
+			return false
+		}
+		for _, component := range components {
+			if matchGlob(glob, component) {
+				return false
+			}
+		}
+	}
+	if len(w.Flags.Include) == 0 {
+		return true
+	}
+	for _, glob := range w.Flags.Include {
+		if matchGlob(glob, rel) || matchGlob(glob, path.Base(rel)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchGlob(glob, name string) bool {
+	matched, _ := path.Match(glob, name)
+	return matched
+}
+
+// pollChanges scans a directory tree at a regular interval
+// and reports files which have been created or changed.
+func pollChanges(root string, interval time.Duration, changes chan<- string) {
+	states, _ := scanTree(root)
+	for range time.Tick(interval) {
+		newStates, err := scanTree(root)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to read directory:", err)
+			continue
+		}
+		for path, state := range newStates {
+			if oldState, ok := states[path]; !ok || oldState != state {
+				changes <- path
+			}
+		}
+		states = newStates
+	}
+}
+
+// scanTree finds the state of every regular file in a
+// directory tree.
+func scanTree(root string) (map[string]fileState, error) {
+	res := map[string]fileState{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// Files may be deleted while we walk.
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			res[path] = fileState{Size: info.Size(), ModTime: info.ModTime()}
+		}
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,203 @@
+// Command sh-plot renders SVG line charts of the numeric
+// "key=value" fields logged by a service, and stores them
+// as media so that anyone viewing the media sees a current
+// learning curve.
+//
+// Each field is plotted by step, along with moving
+// averages of the field, in a file named "<field>.svg".
+// The plots for a service are stored in the media folder
+// "<folder>/<service>", replacing older plots.
+//
+// With -loop, the plots are refreshed periodically.
+// Plots are only uploaded when they change.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+)
+
+type Flags struct {
+	ServiceName  string
+	Folder       string
+	StepField    string
+	FieldNames   []string
+	AvgSizes     []int
+	Width        int
+	Height       int
+	LoopInterval time.Duration
+}
+
+func ParseFlags() *Flags {
+	f := &Flags{}
+
+	var fieldNames string
+	var avgSizes string
+	defaultSizes := make([]string, len(statushub.DefaultAvgSizes))
+	for i, size := range statushub.DefaultAvgSizes {
+		defaultSizes[i] = strconv.Itoa(size)
+	}
+	flag.StringVar(&f.Folder, "folder", "plots", "media folder in which to store the plots")
+	flag.StringVar(&f.StepField, "step", "", "field holding the step of each message")
+	flag.StringVar(&fieldNames, "fields", "", "optional space-delimited whitelist of field names")
+	flag.StringVar(&avgSizes, "avg", strings.Join(defaultSizes, " "),
+		"space-delimited moving average window sizes")
+	flag.IntVar(&f.Width, "width", 640, "width of each plot")
+	flag.IntVar(&f.Height, "height", 400, "height of each plot")
+	flag.DurationVar(&f.LoopInterval, "loop", 0, "interval for refreshing the plots in a loop")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: sh-plot [flags] <service|pattern>")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "The plots for each service are stored in <folder>/<service>.")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "")
+		statushub.PrintEnvUsage(os.Stderr)
+	}
+	flag.Parse()
+
+	if len(flag.Args()) != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	f.ServiceName = flag.Args()[0]
+	f.FieldNames = strings.Fields(fieldNames)
+
+	for _, sizeStr := range strings.Fields(avgSizes) {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || size < 1 {
+			essentials.Die("invalid average size:", sizeStr)
+		}
+		f.AvgSizes = append(f.AvgSizes, size)
+	}
+	if f.Width < plotMarginLeft+plotMarginRight+100 ||
+		f.Height < plotMarginTop+plotMarginBottom+100 {
+		essentials.Die("The plot size is too small.")
+	}
+
+	return f
+}
+
+func main() {
+	flags := ParseFlags()
+
+	client, err := statushub.AuthCLI()
+	if err != nil {
+		essentials.Die("Failed to create client:", err)
+	}
+
+	plotter := NewPlotter(client, flags)
+	for {
+		err := plotter.Update()
+		if flags.LoopInterval == 0 {
+			if err != nil {
+				essentials.Die(err)
+			}
+			break
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		time.Sleep(flags.LoopInterval)
+	}
+}
+
+// A Plotter renders the plots for services and uploads
+// the ones which have changed.
+type Plotter struct {
+	Client *statushub.Client
+	Flags  *Flags
+
+	// uploaded maps media paths to the SHA-256 hashes of
+	// the plots most recently stored there.
+	uploaded map[string]string
+}
+
+// NewPlotter creates a Plotter for the flags.
+func NewPlotter(client *statushub.Client, flags *Flags) *Plotter {
+	return &Plotter{Client: client, Flags: flags, uploaded: map[string]string{}}
+}
+
+// Update refreshes the plots of every matching service.
+//
+// Patterns are resolved on every update, so that new
+// services are plotted as they appear.
+func (p *Plotter) Update() error {
+	serviceNames, err := statushub.ServiceNames(p.Client, p.Flags.ServiceName)
+	if err != nil {
+		return err
+	}
+	for _, name := range serviceNames {
+		if err := p.updateService(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Plotter) updateService(service string) error {
+	log, err := p.Client.ServiceLog(service)
+	if err != nil {
+		return err
+	}
+	series := statushub.ExtractSeries(log, p.Flags.StepField)
+
+	fieldNames := make([]string, 0, len(series))
+	for name := range series {
+		if len(p.Flags.FieldNames) == 0 || essentials.Contains(p.Flags.FieldNames, name) {
+			fieldNames = append(fieldNames, name)
+		}
+	}
+	sort.Strings(fieldNames)
+
+	folder := p.Flags.Folder + statushub.NamespaceSeparator + service
+	for _, name := range fieldNames {
+		data := RenderPlot(name, series[name], p.Flags.AvgSizes, p.Flags.Width, p.Flags.Height)
+		if err := p.upload(folder, name+".svg", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upload stores a plot unless the same plot is already on
+// the server.
+func (p *Plotter) upload(folder, filename string, data []byte) error {
+	mediaPath := folder + statushub.NamespaceSeparator + filename
+	hash := sha256.Sum256(data)
+	hashStr := hex.EncodeToString(hash[:])
+
+	lastHash, ok := p.uploaded[mediaPath]
+	if !ok {
+		// The plot may have been stored by an earlier run.
+		record, err := p.Client.MediaVersion(folder, filename, 0)
+		if err == nil {
+			lastHash, ok = record.SHA256, true
+		} else if !errors.Is(err, statushub.ErrUnknownMedia) {
+			return err
+		}
+	}
+	if ok && lastHash == hashStr {
+		p.uploaded[mediaPath] = hashStr
+		return nil
+	}
+
+	if _, err := p.Client.AddMedia(folder, filename, "image/svg+xml", data, true); err != nil {
+		return essentials.AddCtx("upload "+mediaPath, err)
+	}
+	p.uploaded[mediaPath] = hashStr
+	fmt.Println(mediaPath)
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+
+	"github.com/unixpickle/statushub"
+)
+
+const (
+	plotMarginLeft   = 64
+	plotMarginRight  = 16
+	plotMarginTop    = 36
+	plotMarginBottom = 40
+
+	// maxPlotPoints is roughly the most points drawn for
+	// one line, to keep plots of long logs small.
+	maxPlotPoints = 1000
+)
+
+const rawColor = "#1f77b4"
+
+var avgColors = []string{"#d62728", "#2ca02c", "#9467bd", "#ff7f0e", "#8c564b"}
+
+type plotLine struct {
+	Name    string
+	Color   string
+	Width   float64
+	Opacity float64
+	Points  []statushub.FieldPoint
+}
+
+// RenderPlot creates an SVG line chart of a field's values
+// by step, along with moving averages of the values.
+//
+// Moving averages with windows larger than the number of
+// values are omitted.
+func RenderPlot(field string, points []statushub.FieldPoint, avgSizes []int,
+	width, height int) []byte {
+	lines := []plotLine{{Name: field, Color: rawColor, Width: 1, Opacity: 0.5, Points: points}}
+	for i, size := range avgSizes {
+		if size < 2 || size > len(points) {
+			continue
+		}
+		lines = append(lines, plotLine{
+			Name:    fmt.Sprintf("avg %d", size),
+			Color:   avgColors[i%len(avgColors)],
+			Width:   2,
+			Opacity: 1,
+			Points:  MovingAverage(points, size),
+		})
+	}
+
+	// Moving averages never leave the range of the values,
+	// so the values alone determine the axes.
+	xMin, xMax := math.Inf(1), math.Inf(-1)
+	yMin, yMax := math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		xMin = math.Min(xMin, float64(p.Step))
+		xMax = math.Max(xMax, float64(p.Step))
+		yMin = math.Min(yMin, p.Value)
+		yMax = math.Max(yMax, p.Value)
+	}
+	xTicks := niceTicks(xMin, xMax, 6)
+	yTicks := niceTicks(yMin, yMax, 5)
+	xMin, xMax = xTicks[0], xTicks[len(xTicks)-1]
+	yMin, yMax = yTicks[0], yTicks[len(yTicks)-1]
+
+	plotWidth := float64(width - plotMarginLeft - plotMarginRight)
+	plotHeight := float64(height - plotMarginTop - plotMarginBottom)
+	xCoord := func(x float64) float64 {
+		return plotMarginLeft + plotWidth*(x-xMin)/(xMax-xMin)
+	}
+	yCoord := func(y float64) float64 {
+		return plotMarginTop + plotHeight*(1-(y-yMin)/(yMax-yMin))
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" `+
+		`viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		width, height, width, height)
+	fmt.Fprintln(&buf, `<rect width="100%" height="100%" fill="white"/>`)
+	fmt.Fprintf(&buf, `<text x="%d" y="20" font-size="14" font-weight="bold">%s</text>`+"\n",
+		plotMarginLeft, html.EscapeString(field))
+
+	for _, x := range xTicks {
+		fmt.Fprintf(&buf, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="#e0e0e0"/>`+"\n",
+			xCoord(x), plotMarginTop, xCoord(x), plotMarginTop+plotHeight)
+		fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`+"\n",
+			xCoord(x), plotMarginTop+plotHeight+16, formatTick(x))
+	}
+	for _, y := range yTicks {
+		fmt.Fprintf(&buf, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#e0e0e0"/>`+"\n",
+			plotMarginLeft, yCoord(y), plotMarginLeft+plotWidth, yCoord(y))
+		fmt.Fprintf(&buf, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`+"\n",
+			plotMarginLeft-6, yCoord(y)+4, formatTick(y))
+	}
+	fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%.1f" height="%.1f" fill="none" `+
+		`stroke="#808080"/>`+"\n", plotMarginLeft, plotMarginTop, plotWidth, plotHeight)
+	fmt.Fprintf(&buf, `<text x="%.1f" y="%d" text-anchor="end">step</text>`+"\n",
+		plotMarginLeft+plotWidth, height-6)
+
+	for _, line := range lines {
+		if len(line.Points) == 1 {
+			// A path with one point would be invisible.
+			p := line.Points[0]
+			fmt.Fprintf(&buf, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`+"\n",
+				xCoord(float64(p.Step)), yCoord(p.Value), line.Color)
+			continue
+		}
+		var path bytes.Buffer
+		for i, p := range downsample(line.Points, maxPlotPoints) {
+			if i == 0 {
+				path.WriteString("M")
+			} else {
+				path.WriteString(" L")
+			}
+			fmt.Fprintf(&path, "%.1f %.1f", xCoord(float64(p.Step)), yCoord(p.Value))
+		}
+		fmt.Fprintf(&buf, `<path d="%s" fill="none" stroke="%s" stroke-width="%g" `+
+			`stroke-opacity="%g" stroke-linejoin="round"/>`+"\n", path.String(), line.Color,
+			line.Width, line.Opacity)
+	}
+
+	// The legend shows the latest value of every line.
+	legendX := float64(width - plotMarginRight)
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i]
+		latest := line.Points[len(line.Points)-1].Value
+		label := fmt.Sprintf("%s %s", line.Name, strconv.FormatFloat(latest, 'g', 5, 64))
+		fmt.Fprintf(&buf, `<text x="%.1f" y="20" text-anchor="end" fill="%s">%s</text>`+"\n",
+			legendX, line.Color, html.EscapeString(label))
+		legendX -= 7*float64(len(label)) + 12
+	}
+
+	fmt.Fprintln(&buf, "</svg>")
+	return buf.Bytes()
+}
+
+// MovingAverage computes the mean of the last size values
+// at every point.
+// The first points average fewer values.
+func MovingAverage(points []statushub.FieldPoint, size int) []statushub.FieldPoint {
+	res := make([]statushub.FieldPoint, len(points))
+	var sum float64
+	for i, p := range points {
+		sum += p.Value
+		count := i + 1
+		if i >= size {
+			sum -= points[i-size].Value
+			count = size
+		}
+		p.Value = sum / float64(count)
+		res[i] = p
+	}
+	return res
+}
+
+// downsample reduces a line to at most max points.
+//
+// The points are split into buckets, and the lowest and
+// highest point of each bucket are kept, so that spikes
+// are still visible.
+func downsample(points []statushub.FieldPoint, max int) []statushub.FieldPoint {
+	if len(points) <= max {
+		return points
+	}
+	numBuckets := max / 2
+	res := make([]statushub.FieldPoint, 0, max)
+	for b := 0; b < numBuckets; b++ {
+		start := b * len(points) / numBuckets
+		end := (b + 1) * len(points) / numBuckets
+		low, high := start, start
+		for i := start + 1; i < end; i++ {
+			if points[i].Value < points[low].Value {
+				low = i
+			}
+			if points[i].Value > points[high].Value {
+				high = i
+			}
+		}
+		if low < high {
+			res = append(res, points[low], points[high])
+		} else if high < low {
+			res = append(res, points[high], points[low])
+		} else {
+			res = append(res, points[low])
+		}
+	}
+	return res
+}
+
+// niceTicks chooses about count evenly spaced axis ticks
+// at round numbers which cover a range.
+func niceTicks(min, max float64, count int) []float64 {
+	if max <= min {
+		pad := math.Abs(min) / 10
+		if pad == 0 {
+			pad = 1
+		}
+		min, max = min-pad, max+pad
+	}
+	rough := (max - min) / float64(count)
+	magnitude := math.Pow(10, math.Floor(math.Log10(rough)))
+	step := 10 * magnitude
+	for _, m := range []float64{1, 2, 5} {
+		if m*magnitude >= rough {
+			step = m * magnitude
+			break
+		}
+	}
+	start := math.Floor(min/step) * step
+	end := math.Ceil(max/step) * step
+	var res []float64
+	for i := 0; ; i++ {
+		tick := start + float64(i)*step
+		if tick > end+step/2 {
+			break
+		}
+		if math.Abs(tick) < step*1e-9 {
+			// Avoid labels like "2.7756e-17".
+			tick = 0
+		}
+		res = append(res, tick)
+	}
+	return res
+}
+
+func formatTick(x float64) string {
+	return strconv.FormatFloat(x, 'g', 6, 64)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -14,6 +15,8 @@ func main() {
 	var n int
 	var reconnect bool
 	var timeout time.Duration
+	var minLevel string
+	var labels statushub.Labels
 	flag.Usage = func() {
 		fmt.Fprintln(os.Stderr, "Usage: sh-stream [flags] [service]")
 		flag.PrintDefaults()
@@ -21,21 +24,29 @@ func main() {
 	flag.IntVar(&n, "n", 0, "max number of messages")
 	flag.BoolVar(&reconnect, "reconnect", false, "automatically attempt reconnect")
 	flag.DurationVar(&timeout, "timeout", 0, "max time between log messages")
+	flag.StringVar(&minLevel, "level", "", "minimum log level (debug, info, warn, error)")
+	flag.Var(&labels, "label", "only show messages with a label (key=value, repeatable)")
 	flag.Parse()
 
+	level, err := statushub.ParseLevel(minLevel)
+	if err != nil {
+		essentials.Die(err)
+	}
+	filter := &statushub.LogFilter{MinLevel: level, Labels: labels}
+
 	if len(flag.Args()) != 0 && len(flag.Args()) != 1 {
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	// The client logs in again automatically if the
+	// session expires.
+	client, err := statushub.AuthCLI()
+	if err != nil {
+		essentials.Die(err)
+	}
 	for {
-		// Re-create client each time to avoid having
-		// the session expire.
-		client, err := statushub.AuthCLI()
-		if err != nil {
-			essentials.Die(err)
-		}
-		if err := stream(client, n, timeout); err != nil {
+		if err := stream(client, filter, n, timeout); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			if !reconnect {
 				os.Exit(1)
@@ -44,14 +55,16 @@ func main() {
 	}
 }
 
-func stream(client *statushub.Client, n int, timeout time.Duration) error {
+func stream(client *statushub.Client, filter *statushub.LogFilter, n int,
+	timeout time.Duration) error {
 	var stream <-chan statushub.LogRecord
 	var errChan <-chan error
 
 	if len(flag.Args()) == 0 {
-		stream, errChan = client.FullStream(nil)
+		stream, errChan = client.FullStreamFilterContext(context.Background(), filter)
 	} else {
-		stream, errChan = client.ServiceStream(flag.Args()[0], nil)
+		stream, errChan = client.ServiceStreamFilterContext(context.Background(),
+			flag.Args()[0], filter)
 	}
 
 	var timer *time.Timer
@@ -60,12 +73,17 @@ func stream(client *statushub.Client, n int, timeout time.Duration) error {
 		timer = time.NewTimer(timeout)
 		timerCh = timer.C
 	}
-	for i := 0; i < n || n == 0; i++ {
+	for i := 0; i < n || n == 0; {
 		select {
 		case message, ok := <-stream:
 			if !ok {
-				break
+				return <-errChan
+			}
+			if message.Update {
+				// Only the progress changed.
+				continue
 			}
+			i++
 			fmt.Println(message.Message)
 			if timer != nil {
 				if !timer.Stop() {
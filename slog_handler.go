@@ -0,0 +1,193 @@
+package statushub
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// SlogOptions configures a SlogHandler.
+type SlogOptions struct {
+	// Level is the minimum level of records to send.
+	// If nil, slog.LevelInfo is used.
+	Level slog.Leveler
+
+	// Logger is used to submit messages.
+	// If nil, the handler creates its own AsyncLogger with
+	// default options, which is closed by Close.
+	Logger *AsyncLogger
+}
+
+// A SlogHandler is a slog.Handler which sends log records
+// to a StatusHub service.
+//
+// Records are formatted as the level, the message, and
+// then the attributes as key=value pairs, which allows
+// tools like sh-avg to parse numerical attributes.
+// Each message is sent with the corresponding Level.
+// Attributes inside groups are prefixed with the group
+// names, as in "group.key=value".
+//
+// Messages are queued on an AsyncLogger, so logging does
+// not block on the network.
+type SlogHandler struct {
+	logger  *AsyncLogger
+	owned   bool
+	service string
+	level   slog.Leveler
+
+	// attrs contains the formatted attributes from
+	// WithAttrs, including a leading space.
+	attrs string
+
+	// groupPrefix is the prefix for attribute keys from
+	// WithGroup, such as "a.b.".
+	groupPrefix string
+}
+
+// NewSlogHandler creates a SlogHandler which logs to the
+// given service.
+//
+// If opts is nil, default options are used.
+func NewSlogHandler(c *Client, service string, opts *SlogOptions) *SlogHandler {
+	h := &SlogHandler{
+		service: service,
+		level:   slog.LevelInfo,
+	}
+	if opts != nil {
+		h.logger = opts.Logger
+		if opts.Level != nil {
+			h.level = opts.Level
+		}
+	}
+	if h.logger == nil {
+		// This cannot fail without a spool file.
+		h.logger, _ = NewAsyncLogger(c, nil)
+		h.owned = true
+	}
+	return h
+}
+
+// Enabled checks if the level meets the threshold.
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle formats the record and queues it to be sent.
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var buf strings.Builder
+	buf.WriteString(r.Level.String())
+	buf.WriteByte(' ')
+	buf.WriteString(r.Message)
+	buf.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&buf, h.groupPrefix, a)
+		return true
+	})
+	h.logger.LogEntry(h.service, Entry{Message: buf.String(), Level: slogLevel(r.Level)})
+	return nil
+}
+
+// WithAttrs creates a handler which includes the given
+// attributes in every record.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	var buf strings.Builder
+	buf.WriteString(h.attrs)
+	for _, a := range attrs {
+		appendAttr(&buf, h.groupPrefix, a)
+	}
+	res := *h
+	res.owned = false
+	res.attrs = buf.String()
+	return &res
+}
+
+// WithGroup creates a handler which puts subsequent
+// attributes in a group.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	res := *h
+	res.owned = false
+	res.groupPrefix += name + "."
+	return &res
+}
+
+// Flush attempts to deliver all queued messages.
+func (h *SlogHandler) Flush() error {
+	return h.logger.Flush()
+}
+
+// Close flushes queued messages.
+//
+// If the handler created its own AsyncLogger, the logger
+// is closed as well.
+// Handlers derived with WithAttrs or WithGroup share the
+// original handler's logger and only flush it.
+func (h *SlogHandler) Close() error {
+	if h.owned {
+		return h.logger.Close()
+	}
+	return h.logger.Flush()
+}
+
+func slogLevel(level slog.Level) Level {
+	if level < slog.LevelInfo {
+		return LevelDebug
+	} else if level < slog.LevelWarn {
+		return LevelInfo
+	} else if level < slog.LevelError {
+		return LevelWarn
+	}
+	return LevelError
+}
+
+func appendAttr(buf *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, sub := range a.Value.Group() {
+			appendAttr(buf, prefix, sub)
+		}
+		return
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(prefix)
+	buf.WriteString(a.Key)
+	buf.WriteByte('=')
+	buf.WriteString(formatSlogValue(a.Value))
+}
+
+func formatSlogValue(v slog.Value) string {
+	switch v.Kind() {
+	case slog.KindFloat64:
+		return strconv.FormatFloat(v.Float64(), 'g', -1, 64)
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	}
+	return quoteIfNeeded(v.String())
+}
+
+func quoteIfNeeded(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, ch := range s {
+		if unicode.IsSpace(ch) || ch == '=' || ch == '"' || !unicode.IsPrint(ch) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
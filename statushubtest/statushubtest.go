@@ -0,0 +1,113 @@
+// Package statushubtest provides utilities for testing
+// code which uses a StatusHub client.
+package statushubtest
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/statushub"
+	"github.com/unixpickle/statushub/server"
+)
+
+// Password is the password of servers created by
+// NewServer.
+const Password = "statushubtest"
+
+// WaitTimeout is the amount of time that assertion
+// helpers wait for a condition before failing.
+var WaitTimeout = time.Second * 10
+
+// PollInterval is the interval at which helpers poll the
+// server while waiting for a condition.
+var PollInterval = time.Millisecond * 10
+
+// NewServer starts an in-memory StatusHub server and
+// creates a Client which is logged in to it.
+//
+// The caller should call Close on the server when done.
+func NewServer() (*httptest.Server, *statushub.Client) {
+	blobs, err := server.NewBlobStore("")
+	if err != nil {
+		panic(essentials.AddCtx("statushubtest: create blob store", err))
+	}
+	s := server.NewServer(server.NewConfig(Password), blobs, "", 0)
+	ts := httptest.NewServer(s.Handler())
+	client, err := statushub.NewClient(ts.URL)
+	if err == nil {
+		err = client.Login(Password)
+	}
+	if err != nil {
+		ts.Close()
+		panic(essentials.AddCtx("statushubtest: create client", err))
+	}
+	return ts, client
+}
+
+// WaitForRecords waits until a service has at least n log
+// records and returns its log, sorted by most to least
+// recent.
+//
+// The service does not have to exist when this is called.
+func WaitForRecords(ctx context.Context, c *statushub.Client, service string,
+	n int) ([]statushub.LogRecord, error) {
+	for {
+		log, err := c.ServiceLogContext(ctx, service)
+		if err == nil && len(log) >= n {
+			return log, nil
+		} else if err != nil && !errors.Is(err, statushub.ErrUnknownService) {
+			return nil, err
+		}
+		select {
+		case <-time.After(PollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// AssertRecords is like WaitForRecords, but it fails the
+// test if the records do not show up within WaitTimeout.
+func AssertRecords(t testing.TB, c *statushub.Client, service string,
+	n int) []statushub.LogRecord {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), WaitTimeout)
+	defer cancel()
+	log, err := WaitForRecords(ctx, c, service, n)
+	if err != nil {
+		t.Fatalf("waiting for %d records in service %q: %v", n, service, err)
+	}
+	return log
+}
+
+// AssertMessages waits for a service to have exactly the
+// given messages, listed from least to most recent, and
+// fails the test if it does not.
+func AssertMessages(t testing.TB, c *statushub.Client, service string, messages ...string) {
+	t.Helper()
+	log := AssertRecords(t, c, service, len(messages))
+	if len(log) != len(messages) {
+		t.Fatalf("service %q: expected %d records but got %d", service, len(messages),
+			len(log))
+	}
+	for i, msg := range messages {
+		if actual := log[len(log)-(i+1)].Message; actual != msg {
+			t.Fatalf("service %q: record %d: expected %q but got %q", service, i, msg, actual)
+		}
+	}
+}
+
+// AssertNoService fails the test if the service exists.
+func AssertNoService(t testing.TB, c *statushub.Client, service string) {
+	t.Helper()
+	_, err := c.ServiceLog(service)
+	if err == nil {
+		t.Fatalf("service %q should not exist", service)
+	} else if !errors.Is(err, statushub.ErrUnknownService) {
+		t.Fatalf("check service %q: %v", service, err)
+	}
+}
@@ -0,0 +1,149 @@
+package statushubtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWaitForRecords(t *testing.T) {
+	ts, client := NewServer()
+	defer ts.Close()
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			time.Sleep(PollInterval)
+			if _, err := client.Add("svc", fmt.Sprint("msg", i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), WaitTimeout)
+	defer cancel()
+	log, err := WaitForRecords(ctx, client, "svc", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 3 || log[0].Message != "msg2" || log[2].Message != "msg0" {
+		t.Errorf("unexpected log: %v", log)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), PollInterval*5)
+	defer cancel()
+	if _, err := WaitForRecords(ctx, client, "svc", 4); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error but got %v", err)
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	ts, client := NewServer()
+	defer ts.Close()
+
+	if _, err := client.AddBatch("svc", []string{"hello", "world"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if log := AssertRecords(t, client, "svc", 2); len(log) != 2 {
+		t.Errorf("expected 2 records but got %d", len(log))
+	}
+	AssertMessages(t, client, "svc", "hello", "world")
+	AssertNoService(t, client, "other")
+}
+
+func TestAssertionFailures(t *testing.T) {
+	ts, client := NewServer()
+	defer ts.Close()
+
+	oldTimeout := WaitTimeout
+	WaitTimeout = PollInterval * 5
+	defer func() {
+		WaitTimeout = oldTimeout
+	}()
+
+	if _, err := client.AddBatch("svc", []string{"hello", "world"}); err != nil {
+		t.Fatal(err)
+	}
+
+	failures := []struct {
+		Name    string
+		Message string
+		Assert  func(t *fakeTB)
+	}{
+		{
+			Name:    "MissingRecords",
+			Message: "waiting for 3 records",
+			Assert: func(t *fakeTB) {
+				AssertRecords(t, client, "svc", 3)
+			},
+		},
+		{
+			Name:    "ExtraRecords",
+			Message: "expected 1 records but got 2",
+			Assert: func(t *fakeTB) {
+				AssertMessages(t, client, "svc", "world")
+			},
+		},
+		{
+			Name:    "WrongMessage",
+			Message: `record 1: expected "there" but got "world"`,
+			Assert: func(t *fakeTB) {
+				AssertMessages(t, client, "svc", "hello", "there")
+			},
+		},
+		{
+			Name:    "ServiceExists",
+			Message: `service "svc" should not exist`,
+			Assert: func(t *fakeTB) {
+				AssertNoService(t, client, "svc")
+			},
+		},
+	}
+	for _, failure := range failures {
+		t.Run(failure.Name, func(t *testing.T) {
+			fake := runFakeTB(failure.Assert)
+			if !fake.failed {
+				t.Fatal("assertion did not fail")
+			}
+			if !strings.Contains(fake.message, failure.Message) {
+				t.Errorf("expected message to contain %q but got %q", failure.Message,
+					fake.message)
+			}
+		})
+	}
+}
+
+// fakeTB is a testing.TB which records failures instead of
+// failing the test.
+type fakeTB struct {
+	testing.TB
+
+	failed  bool
+	message string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.failed = true
+	f.message = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+// runFakeTB runs f on its own goroutine, since Fatalf ends
+// the goroutine which calls it.
+func runFakeTB(f func(t *fakeTB)) *fakeTB {
+	fake := &fakeTB{}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f(fake)
+	}()
+	wg.Wait()
+	return fake
+}
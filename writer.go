@@ -0,0 +1,96 @@
+package statushub
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+)
+
+// A Writer is an io.Writer which logs each line written
+// to it as a message for a service.
+//
+// Lines may be split across multiple writes.
+// A trailing partial line is logged when the Writer is
+// closed.
+//
+// Messages are submitted in batches by an AsyncLogger, so
+// writes do not block on the network.
+type Writer struct {
+	logger  *AsyncLogger
+	owned   bool
+	service string
+
+	lock    sync.Mutex
+	partial []byte
+	closed  bool
+}
+
+// NewWriter creates a Writer for the service which uses
+// its own AsyncLogger with default options.
+//
+// Closing the Writer closes the logger.
+func NewWriter(c *Client, service string) *Writer {
+	// This cannot fail without a spool file.
+	logger, _ := NewAsyncLogger(c, nil)
+	return &Writer{logger: logger, owned: true, service: service}
+}
+
+// Writer creates a Writer for the service which submits
+// messages through l.
+//
+// Closing the Writer flushes l, but does not close it.
+func (l *AsyncLogger) Writer(service string) *Writer {
+	return &Writer{logger: l, service: service}
+}
+
+// Write logs every complete line in p, and buffers the
+// rest until the next write.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return 0, errors.New("write log: writer is closed")
+	}
+	data := p
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			break
+		}
+		var line string
+		if len(w.partial) > 0 {
+			line = string(append(w.partial, data[:idx]...))
+			w.partial = w.partial[:0]
+		} else {
+			line = string(data[:idx])
+		}
+		w.logger.Log(w.service, line)
+		data = data[idx+1:]
+	}
+	w.partial = append(w.partial, data...)
+	return len(p), nil
+}
+
+// Flush delivers all complete lines written so far.
+func (w *Writer) Flush() error {
+	return w.logger.Flush()
+}
+
+// Close logs any partial line and flushes or closes the
+// underlying logger.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return errors.New("close log writer: writer is already closed")
+	}
+	w.closed = true
+	if len(w.partial) > 0 {
+		w.logger.Log(w.service, string(w.partial))
+		w.partial = nil
+	}
+	if w.owned {
+		return w.logger.Close()
+	}
+	return w.logger.Flush()
+}